@@ -0,0 +1,320 @@
+package sorm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Filter is a condition which matches all the column values in the map, the
+// columns are rendered in sorted order, a nil value matches null.
+type Filter map[string]interface{}
+
+func (f Filter) ToSQL(d Dialect) (sql string, args []interface{}, err error) {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	conds := make([]Cond, 0, len(keys))
+	for _, k := range keys {
+		conds = append(conds, Eq(k, f[k]))
+	}
+	return And(conds...).ToSQL(d)
+}
+
+// builder renders a statement with "?" placeholders, it's implemented by the
+// Selector so that it can be used as a subquery.
+type builder interface {
+	build() (sql string, args []interface{}, err error)
+}
+
+type compareCond struct {
+	col string
+	op  string
+	val interface{}
+}
+
+func (c *compareCond) ToSQL(d Dialect) (sql string, args []interface{}, err error) {
+	if sub, ok := c.val.(builder); ok {
+		sql, args, err = sub.build()
+		if err != nil {
+			return "", nil, err
+		}
+		return quoteColumn(d, c.col) + " " + c.op + " (" + sql + ")", args, nil
+	}
+	if c.val == nil {
+		switch c.op {
+		case "=":
+			return quoteColumn(d, c.col) + " is null", nil, nil
+		case "<>":
+			return quoteColumn(d, c.col) + " is not null", nil, nil
+		}
+		return "", nil, fmt.Errorf("can not compare column %v with null by %q", c.col, c.op)
+	}
+	return quoteColumn(d, c.col) + " " + c.op + " ?", []interface{}{c.val}, nil
+}
+
+// Eq renders "col = ?", or "col is null" if val is nil, the val of Eq and the
+// other comparisons can be a Selector, which is rendered as a subquery.
+func Eq(col string, val interface{}) Cond {
+	return &compareCond{col: col, op: "=", val: val}
+}
+
+// Ne renders "col <> ?", or "col is not null" if val is nil.
+func Ne(col string, val interface{}) Cond {
+	return &compareCond{col: col, op: "<>", val: val}
+}
+
+// Gt renders "col > ?".
+func Gt(col string, val interface{}) Cond {
+	return &compareCond{col: col, op: ">", val: val}
+}
+
+// Ge renders "col >= ?".
+func Ge(col string, val interface{}) Cond {
+	return &compareCond{col: col, op: ">=", val: val}
+}
+
+// Lt renders "col < ?".
+func Lt(col string, val interface{}) Cond {
+	return &compareCond{col: col, op: "<", val: val}
+}
+
+// Le renders "col <= ?".
+func Le(col string, val interface{}) Cond {
+	return &compareCond{col: col, op: "<=", val: val}
+}
+
+// Like renders "col like ?", the pattern is bound as it is.
+func Like(col string, pattern string) Cond {
+	return &compareCond{col: col, op: "like", val: pattern}
+}
+
+// NotLike renders "col not like ?".
+func NotLike(col string, pattern string) Cond {
+	return &compareCond{col: col, op: "not like", val: pattern}
+}
+
+type inCond struct {
+	col  string
+	vals []interface{}
+	not  bool
+}
+
+func (c *inCond) ToSQL(d Dialect) (sql string, args []interface{}, err error) {
+	op := " in ("
+	if c.not {
+		op = " not in ("
+	}
+
+	vals := c.vals
+	if len(vals) == 1 {
+		if sub, ok := vals[0].(builder); ok {
+			sql, args, err = sub.build()
+			if err != nil {
+				return "", nil, err
+			}
+			return quoteColumn(d, c.col) + op + sql + ")", args, nil
+		}
+
+		// a single slice is expanded, In("id", []int{1, 2}) equals In("id", 1, 2)
+		v := reflect.ValueOf(vals[0])
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+			vals = make([]interface{}, v.Len())
+			for i := range vals {
+				vals[i] = v.Index(i).Interface()
+			}
+		}
+	}
+
+	if len(vals) == 0 {
+		// nothing is in an empty list
+		if c.not {
+			return "1=1", nil, nil
+		}
+		return "1=0", nil, nil
+	}
+
+	sql = quoteColumn(d, c.col) + op + strings.TrimSuffix(strings.Repeat("?,", len(vals)), ",") + ")"
+	return sql, vals, nil
+}
+
+// In renders "col in (?,?...)", a single slice argument is expanded, and a
+// single Selector argument is rendered as a subquery.
+func In(col string, vals ...interface{}) Cond {
+	return &inCond{col: col, vals: vals}
+}
+
+// NotIn renders "col not in (?,?...)", a single slice argument is expanded.
+func NotIn(col string, vals ...interface{}) Cond {
+	return &inCond{col: col, vals: vals, not: true}
+}
+
+// IsNull renders "col is null".
+func IsNull(col string) Cond {
+	return &compareCond{col: col, op: "="}
+}
+
+// NotNull renders "col is not null".
+func NotNull(col string) Cond {
+	return &compareCond{col: col, op: "<>"}
+}
+
+type existsCond struct {
+	sub Selector
+	not bool
+}
+
+func (c *existsCond) ToSQL(d Dialect) (sql string, args []interface{}, err error) {
+	sub, ok := c.sub.(builder)
+	if !ok {
+		return "", nil, fmt.Errorf("exists needs a Selector created by Table.Select")
+	}
+	sql, args, err = sub.build()
+	if err != nil {
+		return "", nil, err
+	}
+	if c.not {
+		return "not exists (" + sql + ")", args, nil
+	}
+	return "exists (" + sql + ")", args, nil
+}
+
+// Exists renders "exists (subquery)".
+func Exists(sub Selector) Cond {
+	return &existsCond{sub: sub}
+}
+
+// NotExists renders "not exists (subquery)".
+func NotExists(sub Selector) Cond {
+	return &existsCond{sub: sub, not: true}
+}
+
+type junctionCond struct {
+	op    string
+	conds []Cond
+}
+
+func (c *junctionCond) ToSQL(d Dialect) (sql string, args []interface{}, err error) {
+	parts := make([]string, 0, len(c.conds))
+	for _, cond := range c.conds {
+		if cond == nil {
+			continue
+		}
+		s, a, err := cond.ToSQL(d)
+		if err != nil {
+			return "", nil, err
+		}
+		if s == "" {
+			continue
+		}
+		parts = append(parts, s)
+		args = append(args, a...)
+	}
+
+	switch len(parts) {
+	case 0:
+		return "", nil, nil
+	case 1:
+		return parts[0], args, nil
+	}
+	return "(" + strings.Join(parts, " "+c.op+" ") + ")", args, nil
+}
+
+// And joins the conditions by "and", the empty ones are skipped.
+func And(conds ...Cond) Cond {
+	return &junctionCond{op: "and", conds: conds}
+}
+
+// Or joins the conditions by "or", the empty ones are skipped.
+func Or(conds ...Cond) Cond {
+	return &junctionCond{op: "or", conds: conds}
+}
+
+type notCond struct {
+	cond Cond
+}
+
+func (c *notCond) ToSQL(d Dialect) (sql string, args []interface{}, err error) {
+	sql, args, err = c.cond.ToSQL(d)
+	if err != nil || sql == "" {
+		return sql, args, err
+	}
+	return "not (" + sql + ")", args, nil
+}
+
+// Not negates the condition.
+func Not(cond Cond) Cond {
+	return &notCond{cond: cond}
+}
+
+type rawCond struct {
+	sql  string
+	args []interface{}
+}
+
+func (c *rawCond) ToSQL(d Dialect) (sql string, args []interface{}, err error) {
+	return c.sql, c.args, nil
+}
+
+// Raw is a sql fragment with "?" placeholders, such as Raw("age > ? + 1", 10).
+func Raw(sql string, args ...interface{}) Cond {
+	return &rawCond{sql: sql, args: args}
+}
+
+// quoteColumn quotes a column name which may be qualified by a table, such as
+// "u.id", an expression such as "count(*)" or a number is left as it is.
+func quoteColumn(d Dialect, col string) string {
+	if col == "" || col[0] >= '0' && col[0] <= '9' {
+		return col
+	}
+	for _, c := range col {
+		if !(c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return col
+		}
+	}
+
+	parts := strings.Split(col, ".")
+	for i, p := range parts {
+		parts[i] = d.Quote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// toCond converts the filter of a table method to a Cond, the filter is a
+// Cond, or a string with args bound to its placeholders, nil means no filter.
+func toCond(filter interface{}, args []interface{}) (cond Cond, err error) {
+	switch f := filter.(type) {
+	case nil:
+		return nil, nil
+	case Cond:
+		if len(args) > 0 {
+			return nil, fmt.Errorf("args can only be used with a string filter")
+		}
+		return f, nil
+	case string:
+		if f == "" {
+			return nil, nil
+		}
+		return Raw(f, args...), nil
+	default:
+		return nil, fmt.Errorf("filter must be a string or Cond, got %T", filter)
+	}
+}
+
+// whereClause renders the filter of a table method as a where clause.
+func whereClause(d Dialect, filter interface{}, args []interface{}) (sql string, whereArgs []interface{}, err error) {
+	cond, err := toCond(filter, args)
+	if err != nil || cond == nil {
+		return "", nil, err
+	}
+
+	sql, whereArgs, err = cond.ToSQL(d)
+	if err != nil || sql == "" {
+		return "", nil, err
+	}
+	return " where " + sql, whereArgs, nil
+}
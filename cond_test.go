@@ -0,0 +1,106 @@
+package sorm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCond(t *testing.T) {
+	mysql := GetDialect("mysql")
+	cases := []struct {
+		cond Cond
+		sql  string
+		args []interface{}
+	}{
+		{Eq("id", 1), "`id` = ?", []interface{}{1}},
+		{Eq("u.id", 1), "`u`.`id` = ?", []interface{}{1}},
+		{Eq("lower(name)", "x"), "lower(name) = ?", []interface{}{"x"}},
+		{Eq("name", nil), "`name` is null", nil},
+		{Ne("name", nil), "`name` is not null", nil},
+		{Ne("id", 1), "`id` <> ?", []interface{}{1}},
+		{Gt("id", 1), "`id` > ?", []interface{}{1}},
+		{Ge("id", 1), "`id` >= ?", []interface{}{1}},
+		{Lt("id", 1), "`id` < ?", []interface{}{1}},
+		{Le("id", 1), "`id` <= ?", []interface{}{1}},
+		{Like("name", "a%"), "`name` like ?", []interface{}{"a%"}},
+		{NotLike("name", "a%"), "`name` not like ?", []interface{}{"a%"}},
+		{In("id", 1, 2), "`id` in (?,?)", []interface{}{1, 2}},
+		{In("id", []int{1, 2}), "`id` in (?,?)", []interface{}{1, 2}},
+		{In("id"), "1=0", nil},
+		{NotIn("id", 1), "`id` not in (?)", []interface{}{1}},
+		{NotIn("id", []string{}), "1=1", nil},
+		{IsNull("name"), "`name` is null", nil},
+		{NotNull("name"), "`name` is not null", nil},
+		{And(Eq("id", 1), Eq("name", "x")), "(`id` = ? and `name` = ?)", []interface{}{1, "x"}},
+		{Or(Eq("id", 1), And(Gt("id", 5), Lt("id", 9))), "(`id` = ? or (`id` > ? and `id` < ?))", []interface{}{1, 5, 9}},
+		{And(Eq("id", 1), And()), "`id` = ?", []interface{}{1}},
+		{And(), "", nil},
+		{Not(In("id", 1, 2)), "not (`id` in (?,?))", []interface{}{1, 2}},
+		{Raw("age > ? + 1", 10), "age > ? + 1", []interface{}{10}},
+		{Filter{"name": "x", "id": 1}, "(`id` = ? and `name` = ?)", []interface{}{1, "x"}},
+	}
+
+	for _, c := range cases {
+		sql, args, err := c.cond.ToSQL(mysql)
+		if err != nil {
+			t.Errorf("%q: %v", c.sql, err)
+			continue
+		}
+		if sql != c.sql || !reflect.DeepEqual(args, c.args) {
+			t.Errorf("got %q %v, expect %q %v", sql, args, c.sql, c.args)
+		}
+	}
+
+	sql, _, _ := Eq("u.id", 1).ToSQL(GetDialect("postgres"))
+	if sql != `"u"."id" = ?` {
+		t.Errorf("postgres got %q", sql)
+	}
+	if _, _, err := Gt("id", nil).ToSQL(mysql); err == nil {
+		t.Errorf("Gt with nil should fail")
+	}
+}
+
+func TestTableCond(t *testing.T) {
+	db, rec := newRecorderDB("postgres", t)
+	defer db.Close()
+
+	tb, err := db.BindTable("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tb.Update(And(Gt("id", 1), Eq("name", "x")), map[string]interface{}{"dummy": "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _ := rec.last()
+	if sql != `update xx set "dummy"=$1 where ("id" > $2 and "name" = $3)` {
+		t.Errorf("Update got %q", sql)
+	}
+
+	_, err = tb.Delete(Filter{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _ = rec.last()
+	if sql != `delete from xx where "id" = $1` {
+		t.Errorf("Delete got %q", sql)
+	}
+
+	res, err := tb.Query(And())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Close()
+	sql, _ = rec.last()
+	if sql != `select * from xx` {
+		t.Errorf("Query got %q", sql)
+	}
+
+	if _, err = tb.Query(Eq("id", 1), 1); err == nil {
+		t.Errorf("Query with a Cond and args should fail")
+	}
+	if _, err = tb.Query(1); err == nil {
+		t.Errorf("Query with an int filter should fail")
+	}
+}
@@ -1,40 +1,52 @@
 package sorm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
 type database struct {
-	dbtype string  // just now only support "mysql"
-	dsn    string  // connection string
-	db     *sql.DB // underlying sql connection
+	dialect Dialect      // sql syntax of the database
+	dsn     string       // connection string
+	db      *sql.DB      // underlying sql connection
+	mapper  atomic.Value // the *mapper mapping the structs to the columns
 }
 
-func (db *database) open(conn string) (err error) {
+func (db *database) open(conn string, ping bool) (err error) {
 	if conn == "" {
-		return fmt.Errorf("invalid db connection string")
+		return ErrInvalidDSN
 	}
 	db.dsn = conn
 
-	db.db, err = sql.Open("mysql", conn)
+	db.db, err = sql.Open(db.dialect.DriverName(), conn)
 	if err != nil {
 		return err
 	}
 
-	err = db.db.Ping()
-	if err != nil {
-		return err
+	if ping {
+		err = db.db.Ping()
+		if err != nil {
+			db.db.Close()
+			db.db = nil
+			return &PingError{Err: err}
+		}
 	}
 	return nil
 }
 
 func (db *database) Exec(sql string, args ...interface{}) (res sql.Result, err error) {
+	return db.ExecContext(context.Background(), sql, args...)
+}
+
+func (db *database) ExecContext(ctx context.Context, sql string, args ...interface{}) (res sql.Result, err error) {
 	if db.db == nil {
 		return nil, fmt.Errorf("db is not opened")
 	}
-	return db.db.Exec(sql, args...)
+	res, err = db.db.ExecContext(ctx, Rebind(db.dialect.BindType(), sql), args...)
+	return res, ctxErr(ctx, err)
 }
 
 func (db *database) Close() (err error) {
@@ -54,16 +66,64 @@ func (db *database) BindTable(tn string) (t Table, err error) {
 	return tbl, nil
 }
 
+func (db *database) BindStruct(obj interface{}) (t Table, err error) {
+	tn, err := tableName(db.dialect, db.structMapper(), obj)
+	if err != nil {
+		return nil, err
+	}
+	return db.BindTable(tn)
+}
+
+// SetNamingStrategy is safe to call along with the statements, it maps the
+// columns of all the tables of the database, including the ones bound before,
+// but not of the transactions already begun. A table bound by BindStruct keeps
+// the name inferred when it's bound, so set the strategy before binding.
+func (db *database) SetNamingStrategy(ns NamingStrategy) {
+	db.mapper.Store(newMapper(ns))
+}
+
+func (db *database) structMapper() *mapper {
+	if m, ok := db.mapper.Load().(*mapper); ok {
+		return m
+	}
+	return defaultMapper
+}
+
+func (db *database) Begin() (t Tx, err error) {
+	return db.BeginTx(context.Background(), nil)
+}
+
+// BeginTx starts a transaction, the retry settings of opts are not used.
+func (db *database) BeginTx(ctx context.Context, opts *TxOptions) (t Tx, err error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("db is not opened")
+	}
+
+	var txOpts *sql.TxOptions
+	if opts != nil {
+		txOpts = &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+	}
+	stx, err := db.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	return &tx{dialect: db.dialect, tx: stx, mapper: db.structMapper()}, nil
+}
+
 func (db *database) CreateQuery(sql string) (q Query, err error) {
+	return db.CreateQueryContext(context.Background(), sql)
+}
+
+func (db *database) CreateQueryContext(ctx context.Context, sql string) (q Query, err error) {
 	if db.db == nil {
 		return nil, fmt.Errorf("db is not opened")
 
 	}
 
-	qr := &query{sql: sql}
-	qr.stmt, err = db.db.Prepare(sql)
+	qr := &query{sql: Rebind(db.dialect.BindType(), sql), mapper: db.structMapper()}
+	qr.stmt, err = db.db.PrepareContext(ctx, qr.sql)
 	if err != nil {
-		return nil, err
+		return nil, ctxErr(ctx, err)
 	}
 	return qr, err
 }
@@ -85,3 +145,11 @@ func (db *database) SetMaxOpenConns(n int) {
 		db.db.SetMaxOpenConns(n)
 	}
 }
+
+func (db *database) Dialect() Dialect {
+	return db.dialect
+}
+
+func (db *database) DB() *sql.DB {
+	return db.db
+}
@@ -1,6 +1,10 @@
 package sorm
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -69,3 +73,127 @@ func TestDatabase(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestOpenDB(t *testing.T) {
+	sqldb, err := sql.Open("mysql", CONN_STRING)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = OpenDB("oracle", sqldb); err == nil {
+		t.Fatal("OpenDB with unsupported dbtype should fail")
+	}
+	db, err := OpenDB("mysql", sqldb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.DB() != sqldb {
+		t.Fatal("db.DB() should return the wrapped pool")
+	}
+	if db.Dialect().Name() != "mysql" {
+		t.Fatalf("db.Dialect().Name()=%q, expect \"mysql\"", db.Dialect().Name())
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.DB() != nil {
+		t.Fatal("db.DB() should be nil after closed")
+	}
+}
+
+func TestOpenConnector(t *testing.T) {
+	db, rec := newRecorderDB("postgres", t)
+	defer db.Close()
+
+	_, err := db.Exec("INSERT INTO xx(id, name, dummy) VALUES(?,?,?)", 1, "name1", "dummy1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args := rec.last()
+	if sql != "INSERT INTO xx(id, name, dummy) VALUES($1,$2,$3)" {
+		t.Errorf("got sql %q", sql)
+	}
+	if len(args) != 3 || args[0] != int64(1) {
+		t.Errorf("got args %v", args)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	_, err := Open("oracle", CONN_STRING)
+	if !errors.Is(err, ErrUnsupportedDialect) {
+		t.Errorf("Open with unsupported dbtype, err=%v, expect ErrUnsupportedDialect", err)
+	}
+	_, err = Open("mysql", "")
+	if !errors.Is(err, ErrInvalidDSN) {
+		t.Errorf("Open with empty dsn, err=%v, expect ErrInvalidDSN", err)
+	}
+
+	// nothing listens on the port
+	_, err = Open("mysql", "root:root@tcp(127.0.0.1:1)/world")
+	var pe *PingError
+	if !errors.As(err, &pe) {
+		t.Errorf("Open with unreachable server, err=%v, expect *PingError", err)
+	}
+
+	db, err := Open("mysql", "root:root@tcp(127.0.0.1:1)/world", SkipPing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+}
+
+func TestContext(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := db.ExecContext(ctx, "delete from xx")
+	if err != context.Canceled {
+		t.Errorf("db.ExecContext err=%v, expect context.Canceled", err)
+	}
+	_, err = db.CreateQueryContext(ctx, "select * from xx")
+	if err != context.Canceled {
+		t.Errorf("db.CreateQueryContext err=%v, expect context.Canceled", err)
+	}
+
+	tb, err := db.BindTable("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tb.QueryContext(ctx, "")
+	if err != context.Canceled {
+		t.Errorf("tb.QueryContext err=%v, expect context.Canceled", err)
+	}
+	_, err = tb.DeleteContext(ctx, "")
+	if err != context.Canceled {
+		t.Errorf("tb.DeleteContext err=%v, expect context.Canceled", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	_, err = tb.InsertContext(ctx, 1, "name1", "dummy1")
+	if err != context.DeadlineExceeded {
+		t.Errorf("tb.InsertContext err=%v, expect context.DeadlineExceeded", err)
+	}
+
+	if sqls := rec.sqls; len(sqls) != 0 {
+		t.Errorf("no sql should be executed, got %q", sqls)
+	}
+
+	// a real failure is not hidden by the cancellation
+	dup := errors.New("Error 1062: Duplicate entry")
+	if err = ctxErr(ctx, dup); err != dup {
+		t.Errorf("ctxErr got %v, expect %v", err, dup)
+	}
+	if err = ctxErr(ctx, driver.ErrBadConn); err != context.DeadlineExceeded {
+		t.Errorf("ctxErr got %v, expect context.DeadlineExceeded", err)
+	}
+	if err = ctxErr(context.Background(), driver.ErrBadConn); err != driver.ErrBadConn {
+		t.Errorf("ctxErr got %v, expect driver.ErrBadConn", err)
+	}
+}
@@ -0,0 +1,341 @@
+package sorm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BindType is the placeholder style used for bind parameters.
+type BindType int
+
+const (
+	BindQuestion BindType = iota // ?, used by mysql and sqlite3
+	BindDollar                   // $1, $2..., used by postgres
+)
+
+// InsertIdStrategy tells how the id generated by an insert is read back.
+type InsertIdStrategy int
+
+const (
+	InsertIdLastInsertId InsertIdStrategy = iota // sql.Result.LastInsertId
+	InsertIdReturning                            // insert ... returning col
+)
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = make(map[string]Dialect)
+)
+
+func init() {
+	RegisterDialect("mysql", &mysqlDialect{baseDialect: baseDialect{driver: "mysql"}})
+	RegisterDialect("mysql8", &mysqlDialect{baseDialect: baseDialect{driver: "mysql"}, rowAlias: true})
+	RegisterDialect("sqlite3", &sqlite3Dialect{baseDialect{driver: "sqlite3"}})
+	RegisterDialect("postgres", &postgresDialect{baseDialect{driver: "postgres"}})
+	RegisterDialect("pgx", &postgresDialect{baseDialect{driver: "pgx"}})
+}
+
+// RegisterDialect makes a dialect available by the provided name, the name is
+// the dbtype passed to NewDatabase. Registering the same name twice replaces
+// the previous dialect.
+func RegisterDialect(name string, d Dialect) {
+	if d == nil {
+		panic("sorm: RegisterDialect dialect is nil")
+	}
+
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[name] = d
+}
+
+// GetDialect returns the dialect registered by name, or nil if not found.
+func GetDialect(name string) Dialect {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	return dialects[name]
+}
+
+var (
+	_ RetryDialect        = &mysqlDialect{}
+	_ RetryDialect        = &postgresDialect{}
+	_ SavepointDialect    = &baseDialect{}
+	_ BatchDialect        = &sqlite3Dialect{}
+	_ InsertIgnoreDialect = &mysqlDialect{}
+	_ UpsertDialect       = &mysqlDialect{}
+	_ UpsertDialect       = &baseDialect{}
+)
+
+// baseDialect holds the behaviour shared by the built-in dialects.
+type baseDialect struct {
+	driver string
+}
+
+func (d *baseDialect) DriverName() string {
+	return d.driver
+}
+
+func (d *baseDialect) BindType() BindType {
+	return BindQuestion
+}
+
+func (d *baseDialect) Quote(ident string) string {
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+func (d *baseDialect) Limit(limit, offset int) string {
+	switch {
+	case limit > 0 && offset > 0:
+		return fmt.Sprintf("limit %v offset %v", limit, offset)
+	case limit > 0:
+		return fmt.Sprintf("limit %v", limit)
+	case offset > 0:
+		return fmt.Sprintf("offset %v", offset)
+	}
+	return ""
+}
+
+func (d *baseDialect) MaxBindVars() int {
+	return 65535
+}
+
+func (d *baseDialect) InsertIdStrategy() InsertIdStrategy {
+	return InsertIdLastInsertId
+}
+
+func (d *baseDialect) InsertIgnore() (verb, suffix string) {
+	return "insert into", " on conflict do nothing"
+}
+
+// Upsert renders "on conflict (...) do update set col=excluded.col", the
+// syntax shared by postgres and sqlite3.
+func (d *baseDialect) Upsert(conflictCols, updateCols []string) (string, error) {
+	return conflictUpsert(d.Quote, d.driver, conflictCols, updateCols)
+}
+
+func conflictUpsert(quote func(string) string, name string, conflictCols, updateCols []string) (string, error) {
+	if len(conflictCols) == 0 {
+		return "", fmt.Errorf("%v upsert needs the conflict columns", name)
+	}
+
+	conflict := make([]string, len(conflictCols))
+	for i, c := range conflictCols {
+		conflict[i] = quote(c)
+	}
+	if len(updateCols) == 0 {
+		return "on conflict (" + strings.Join(conflict, ",") + ") do nothing", nil
+	}
+
+	sets := make([]string, len(updateCols))
+	for i, c := range updateCols {
+		sets[i] = quote(c) + "=excluded." + quote(c)
+	}
+	return "on conflict (" + strings.Join(conflict, ",") + ") do update set " + strings.Join(sets, ","), nil
+}
+
+func (d *baseDialect) IsRetryable(err error) bool {
+	return false
+}
+
+func (d *baseDialect) Savepoint(name string) string {
+	return "savepoint " + name
+}
+
+func (d *baseDialect) ReleaseSavepoint(name string) string {
+	return "release savepoint " + name
+}
+
+func (d *baseDialect) RollbackToSavepoint(name string) string {
+	return "rollback to savepoint " + name
+}
+
+type mysqlDialect struct {
+	baseDialect
+	rowAlias bool // refer to the inserted row by an alias, since mysql 8.0.19
+}
+
+func (d *mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (d *mysqlDialect) Quote(ident string) string {
+	return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+}
+
+func (d *mysqlDialect) Limit(limit, offset int) string {
+	if limit <= 0 && offset > 0 {
+		// mysql has no offset without limit, use the max row count instead
+		return fmt.Sprintf("limit 18446744073709551615 offset %v", offset)
+	}
+	return d.baseDialect.Limit(limit, offset)
+}
+
+func (d *mysqlDialect) InsertIgnore() (verb, suffix string) {
+	return "insert ignore into", ""
+}
+
+// Upsert renders "on duplicate key update col=values(col)", mysql finds the
+// conflict by all the unique keys, so conflictCols is only used when nothing
+// is to update. The values function is deprecated since mysql 8.0.20 but it's
+// the only syntax of mariadb and the older versions, the "mysql8" dialect
+// renders "as new on duplicate key update col=new.col" instead.
+func (d *mysqlDialect) Upsert(conflictCols, updateCols []string) (string, error) {
+	if len(updateCols) == 0 {
+		if len(conflictCols) == 0 {
+			return "", fmt.Errorf("mysql upsert needs the conflict or update columns")
+		}
+		// keep the row as it is
+		c := d.Quote(conflictCols[0])
+		return "on duplicate key update " + c + "=" + c, nil
+	}
+
+	sets := make([]string, len(updateCols))
+	for i, c := range updateCols {
+		if d.rowAlias {
+			sets[i] = d.Quote(c) + "=new." + d.Quote(c)
+		} else {
+			sets[i] = d.Quote(c) + "=values(" + d.Quote(c) + ")"
+		}
+	}
+	if d.rowAlias {
+		return "as new on duplicate key update " + strings.Join(sets, ","), nil
+	}
+	return "on duplicate key update " + strings.Join(sets, ","), nil
+}
+
+func (d *mysqlDialect) IsRetryable(err error) bool {
+	n, ok := errorNumber(err)
+	// 1213 deadlock found, 1205 lock wait timeout
+	return ok && (n == 1213 || n == 1205)
+}
+
+type sqlite3Dialect struct {
+	baseDialect
+}
+
+func (d *sqlite3Dialect) Name() string {
+	return "sqlite3"
+}
+
+func (d *sqlite3Dialect) Limit(limit, offset int) string {
+	if limit <= 0 && offset > 0 {
+		return fmt.Sprintf("limit -1 offset %v", offset)
+	}
+	return d.baseDialect.Limit(limit, offset)
+}
+
+func (d *sqlite3Dialect) MaxBindVars() int {
+	// SQLITE_MAX_VARIABLE_NUMBER before 3.32.0, it's 32766 since then
+	return 999
+}
+
+type postgresDialect struct {
+	baseDialect
+}
+
+func (d *postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (d *postgresDialect) BindType() BindType {
+	return BindDollar
+}
+
+func (d *postgresDialect) InsertIdStrategy() InsertIdStrategy {
+	return InsertIdReturning
+}
+
+func (d *postgresDialect) IsRetryable(err error) bool {
+	state := sqlState(err)
+	// 40001 serialization failure, 40P01 deadlock detected
+	return state == "40001" || state == "40P01"
+}
+
+// defaultDialect provides the optional features a dialect doesn't implement.
+var defaultDialect = &baseDialect{}
+
+func isRetryable(d Dialect, err error) bool {
+	if rd, ok := d.(RetryDialect); ok {
+		return rd.IsRetryable(err)
+	}
+	return defaultDialect.IsRetryable(err)
+}
+
+func savepointDialect(d Dialect) SavepointDialect {
+	if sd, ok := d.(SavepointDialect); ok {
+		return sd
+	}
+	return defaultDialect
+}
+
+func maxBindVars(d Dialect) int {
+	if bd, ok := d.(BatchDialect); ok {
+		return bd.MaxBindVars()
+	}
+	return defaultDialect.MaxBindVars()
+}
+
+func insertIgnore(d Dialect) (verb, suffix string) {
+	if id, ok := d.(InsertIgnoreDialect); ok {
+		return id.InsertIgnore()
+	}
+	return defaultDialect.InsertIgnore()
+}
+
+// upsertClause quotes the columns by d if it's not an UpsertDialect.
+func upsertClause(d Dialect, conflictCols, updateCols []string) (string, error) {
+	if ud, ok := d.(UpsertDialect); ok {
+		return ud.Upsert(conflictCols, updateCols)
+	}
+	return conflictUpsert(d.Quote, d.Name(), conflictCols, updateCols)
+}
+
+// Rebind replaces the "?" placeholders in query with the style of bt, the
+// question marks inside quoted literals, quoted identifiers and comments are
+// left untouched.
+func Rebind(bt BindType, query string) string {
+	if bt == BindQuestion || strings.IndexByte(query, '?') < 0 {
+		return query
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// a doubled quote inside the literal simply ends and restarts it
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				sb.WriteString(query[i:])
+				return sb.String()
+			}
+			sb.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				sb.WriteString(query[i:])
+				return sb.String()
+			}
+			sb.WriteString(query[i : i+end+1])
+			i += end
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				sb.WriteString(query[i:])
+				return sb.String()
+			}
+			sb.WriteString(query[i : i+end+4])
+			i += end + 3
+		case c == '?':
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,133 @@
+package sorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDialect(t *testing.T) {
+	cases := []struct {
+		name   string
+		driver string
+		bind   BindType
+		ident  string
+		quote  string
+		limit  string
+		offset string
+	}{
+		{"mysql", "mysql", BindQuestion, "a`b", "`a``b`", "limit 10 offset 5", "limit 18446744073709551615 offset 5"},
+		{"mysql8", "mysql", BindQuestion, "a`b", "`a``b`", "limit 10 offset 5", "limit 18446744073709551615 offset 5"},
+		{"sqlite3", "sqlite3", BindQuestion, `a"b`, `"a""b"`, "limit 10 offset 5", "limit -1 offset 5"},
+		{"postgres", "postgres", BindDollar, `a"b`, `"a""b"`, "limit 10 offset 5", "offset 5"},
+	}
+
+	for _, c := range cases {
+		d := GetDialect(c.name)
+		if d == nil {
+			t.Fatalf("dialect %q is not registered", c.name)
+		}
+		if d.DriverName() != c.driver {
+			t.Errorf("%v: DriverName()=%q, expect %q", c.name, d.DriverName(), c.driver)
+		}
+		if d.BindType() != c.bind {
+			t.Errorf("%v: BindType()=%v, expect %v", c.name, d.BindType(), c.bind)
+		}
+		if q := d.Quote(c.ident); q != c.quote {
+			t.Errorf("%v: Quote()=%q, expect %q", c.name, q, c.quote)
+		}
+		if l := d.Limit(10, 5); l != c.limit {
+			t.Errorf("%v: Limit(10, 5)=%q, expect %q", c.name, l, c.limit)
+		}
+		if l := d.Limit(0, 5); l != c.offset {
+			t.Errorf("%v: Limit(0, 5)=%q, expect %q", c.name, l, c.offset)
+		}
+		if l := d.Limit(0, 0); l != "" {
+			t.Errorf("%v: Limit(0, 0)=%q, expect \"\"", c.name, l)
+		}
+	}
+
+	if GetDialect("oracle") != nil {
+		t.Errorf("GetDialect(\"oracle\") should be nil")
+	}
+	RegisterDialect("mysql-alias", GetDialect("mysql"))
+	if d := GetDialect("mysql-alias"); d == nil || d.Name() != "mysql" {
+		t.Errorf("RegisterDialect failed")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{"select * from xx", "select * from xx"},
+		{"insert into xx(id,name) values(?,?)", "insert into xx(id,name) values($1,$2)"},
+		{"select * from xx where name='?' and id=?", "select * from xx where name='?' and id=$1"},
+		{"select * from xx where name='it''s?' and id=?", "select * from xx where name='it''s?' and id=$1"},
+		{`select "a?" from xx where id=?`, `select "a?" from xx where id=$1`},
+		{"select * from xx -- id=?\nwhere id=?", "select * from xx -- id=?\nwhere id=$1"},
+		{"select /* ? */ * from xx where id=? and name=?", "select /* ? */ * from xx where id=$1 and name=$2"},
+		{"select * from xx where name='?", "select * from xx where name='?"},
+	}
+
+	for _, c := range cases {
+		if s := Rebind(BindQuestion, c.in); s != c.in {
+			t.Errorf("Rebind(BindQuestion, %q)=%q, expect unchanged", c.in, s)
+		}
+		if s := Rebind(BindDollar, c.in); s != c.out {
+			t.Errorf("Rebind(BindDollar, %q)=%q, expect %q", c.in, s, c.out)
+		}
+	}
+}
+
+// minimalDialect implements none of the optional interfaces.
+type minimalDialect struct{}
+
+func (d minimalDialect) Name() string                       { return "minimal" }
+func (d minimalDialect) DriverName() string                 { return "minimal" }
+func (d minimalDialect) BindType() BindType                 { return BindQuestion }
+func (d minimalDialect) Quote(ident string) string          { return "[" + ident + "]" }
+func (d minimalDialect) Limit(limit, offset int) string     { return "" }
+func (d minimalDialect) InsertIdStrategy() InsertIdStrategy { return InsertIdLastInsertId }
+
+func TestDialectDefaults(t *testing.T) {
+	RegisterDialect("minimal", minimalDialect{})
+	db, rec := newRecorderDB("minimal", t)
+	defer db.Close()
+	tb, _ := db.BindTable("xx")
+
+	_, err := tb.Insert(map[string]interface{}{"id": 1}, IgnoreDuplicates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into xx([id]) values(?) on conflict do nothing" {
+		t.Errorf("Insert got %q", query)
+	}
+
+	_, err = tb.Upsert(&keyed{Id: 1, Name: "n"}, []string{"id"}, []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into xx([id],[name],[dummy]) values(?,?,?) on conflict ([id]) do update set [name]=excluded.[name]" {
+		t.Errorf("Upsert got %q", query)
+	}
+
+	rec.reset()
+	err = db.RunInTx(context.Background(), nil, func(tx Tx) error {
+		return tx.RunInTx(context.Background(), nil, func(tx Tx) error {
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rec.sqls, []string{"BEGIN", "savepoint sorm_sp_1", "release savepoint sorm_sp_1", "COMMIT"}) {
+		t.Errorf("RunInTx got %v", rec.sqls)
+	}
+
+	if isRetryable(minimalDialect{}, errors.New("deadlock")) || maxBindVars(minimalDialect{}) != 65535 {
+		t.Errorf("wrong defaults")
+	}
+}
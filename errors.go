@@ -0,0 +1,74 @@
+package sorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+)
+
+var (
+	// ErrUnsupportedDialect is returned when the dbtype is not a registered dialect.
+	ErrUnsupportedDialect = errors.New("sorm: unsupported dialect")
+	// ErrInvalidDSN is returned when the connection string is empty.
+	ErrInvalidDSN = errors.New("sorm: invalid db connection string")
+)
+
+// PingError is returned by Open when the database is opened but can not be
+// reached, Err is the original error of the driver.
+type PingError struct {
+	Err error
+}
+
+func (e *PingError) Error() string {
+	return "sorm: ping database failed: " + e.Err.Error()
+}
+
+func (e *PingError) Unwrap() error {
+	return e.Err
+}
+
+// errorNumber returns the vendor error number of a driver error, such as
+// the Number field of *mysql.MySQLError, it's found by reflection so that
+// sorm doesn't depend on the drivers.
+func errorNumber(err error) (n uint64, ok bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.Indirect(reflect.ValueOf(err))
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		f := v.FieldByName("Number")
+		switch f.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return f.Uint(), true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return uint64(f.Int()), true
+		}
+	}
+	return 0, false
+}
+
+// sqlState returns the SQLSTATE code of a driver error which has a SQLState
+// method, such as *pgconn.PgError and *pq.Error.
+func sqlState(err error) string {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if se, ok := err.(interface{ SQLState() string }); ok {
+			return se.SQLState()
+		}
+	}
+	return ""
+}
+
+// ctxErr returns the error of ctx if it's done and err is caused by it, as the
+// drivers may report a canceled statement by their own error, such as
+// driver.ErrBadConn. Any other error, such as a constraint violation which
+// happened before the cancellation, is returned as it is.
+func ctxErr(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,290 @@
+package sorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// InsertOption changes how Table.Insert works, it's passed along with the
+// values, such as Insert(&rows, BatchSize(500), BatchInTx()).
+type InsertOption func(*insertOptions)
+
+type insertOptions struct {
+	batchSize int  // max rows of a statement, 0 means limited by the placeholders only
+	inTx      bool // run all the statements of a batch in one transaction
+	ignore    bool // skip the rows conflicting with the existing ones
+
+	upsert       bool     // update the row on a conflict
+	conflictCols []string // the unique columns of the conflict
+	updateCols   []string // the columns to update, all but the conflict ones if empty
+}
+
+// BatchSize limits the rows inserted by one statement of a batch insert.
+func BatchSize(n int) InsertOption {
+	return func(o *insertOptions) {
+		o.batchSize = n
+	}
+}
+
+// BatchInTx runs the statements of a batch insert in one transaction, it has
+// no effect if the table is already bound to a Tx.
+func BatchInTx() InsertOption {
+	return func(o *insertOptions) {
+		o.inTx = true
+	}
+}
+
+// IgnoreDuplicates skips the rows conflicting with the existing ones, by
+// insert ignore on mysql and on conflict do nothing on postgres and sqlite3,
+// the RowsAffected of the result is the count of the rows really inserted.
+func IgnoreDuplicates() InsertOption {
+	return func(o *insertOptions) {
+		o.ignore = true
+	}
+}
+
+// splitInsertOptions separates the options from the values of Table.Insert.
+func splitInsertOptions(values []interface{}) (vals []interface{}, o *insertOptions) {
+	o = &insertOptions{}
+	vals = make([]interface{}, 0, len(values))
+	for _, v := range values {
+		if opt, ok := v.(InsertOption); ok {
+			opt(o)
+			continue
+		}
+		vals = append(vals, v)
+	}
+	return vals, o
+}
+
+// batchRows returns the slice if obj is a slice or a pointer of slice of
+// structs or maps.
+func batchRows(obj interface{}) (rows reflect.Value, ok bool) {
+	rows = reflect.ValueOf(obj)
+	if rows.Kind() == reflect.Ptr {
+		rows = rows.Elem()
+	}
+	if rows.Kind() != reflect.Slice {
+		return rows, false
+	}
+	et := rows.Type().Elem()
+	if et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	return rows, et.Kind() == reflect.Struct || et.Kind() == reflect.Map
+}
+
+// batchGroup is the rows of a batch insert written to the same columns.
+type batchGroup struct {
+	cols   []string
+	values [][]interface{}
+	update []string // the columns updated by an upsert by default, all but the insertonly ones
+}
+
+// batchValues returns the columns and the values of the rows, the columns are
+// in the order of the struct fields or the sorted map keys. A zero autoincr
+// or omitempty field is left to the database, so the struct rows are grouped
+// by the columns written, in the order of their first rows. A readonly column
+// is never written, and all the map rows must have the same keys.
+func batchValues(m *mapper, rows reflect.Value) (groups []*batchGroup, err error) {
+	index := make(map[string]*batchGroup)
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+		if row.Kind() == reflect.Ptr {
+			if row.IsNil() {
+				return nil, fmt.Errorf("row %v is nil", i)
+			}
+			row = row.Elem()
+		}
+
+		var cols, update []string
+		var vals []interface{}
+		switch row.Kind() {
+		case reflect.Struct:
+			for _, ti := range m.getFieldInfoFromStruct(row) {
+				if ti.readonly || (ti.autoincr || ti.omitempty) && ti.fp.Elem().IsZero() {
+					continue
+				}
+				cols = append(cols, ti.fn)
+				vals = append(vals, ti.value())
+				if !ti.insertonly {
+					update = append(update, ti.fn)
+				}
+			}
+		case reflect.Map:
+			keys, err := sortedMapKeys(row)
+			if err != nil {
+				return nil, err
+			}
+			for _, k := range keys {
+				cols = append(cols, k.String())
+				vals = append(vals, row.MapIndex(k).Interface())
+			}
+			update = cols
+		}
+
+		key := strings.Join(cols, ",")
+		g := index[key]
+		if g == nil {
+			if row.Kind() == reflect.Map && len(groups) > 0 {
+				return nil, fmt.Errorf("row %v has columns %v, but the first row has %v", i, key, strings.Join(groups[0].cols, ","))
+			}
+			g = &batchGroup{cols: cols, update: update}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		g.values = append(g.values, vals)
+	}
+	return groups, nil
+}
+
+// insertBatch inserts the rows by multi-row statements, each statement binds
+// no more placeholders than the dialect allows. The generated ids are not
+// written back into the rows.
+func (t *table) insertBatch(ctx context.Context, rows reflect.Value, o *insertOptions) (res sql.Result, err error) {
+	if rows.Len() == 0 {
+		return nil, fmt.Errorf("no rows to insert")
+	}
+	groups, err := batchValues(t.db.structMapper(), rows)
+	if err != nil {
+		return nil, err
+	}
+
+	type statement struct {
+		sql  string
+		args []interface{}
+	}
+	var stmts []statement
+	for _, g := range groups {
+		if len(g.cols) == 0 {
+			return nil, fmt.Errorf("no valid fields found in the object")
+		}
+		size := maxBindVars(t.db.Dialect()) / len(g.cols)
+		if size < 1 {
+			return nil, fmt.Errorf("%v columns exceed the placeholder limit of %v", len(g.cols), t.db.Dialect().Name())
+		}
+		if o.batchSize > 0 && o.batchSize < size {
+			size = o.batchSize
+		}
+
+		verb, suffix := "insert into", ""
+		if o.ignore {
+			verb, suffix = insertIgnore(t.db.Dialect())
+		}
+		if o.upsert {
+			update := o.updateCols
+			if len(update) == 0 {
+				update = exclude(g.update, o.conflictCols)
+			}
+			suffix, err = upsertClause(t.db.Dialect(), o.conflictCols, update)
+			if err != nil {
+				return nil, err
+			}
+			suffix = " " + suffix
+		}
+
+		for start := 0; start < len(g.values); start += size {
+			end := start + size
+			if end > len(g.values) {
+				end = len(g.values)
+			}
+			sql, args := batchInsertSql(t.db.Dialect(), verb, t.name, g.cols, g.values[start:end])
+			stmts = append(stmts, statement{sql + suffix, args})
+		}
+	}
+
+	run := func(db executor) (sql.Result, error) {
+		total := &insertResult{}
+		for _, stmt := range stmts {
+			if printSql {
+				fmt.Printf("table.Insert: %v, args %v\n", stmt.sql, stmt.args)
+			}
+			res, err := db.ExecContext(ctx, stmt.sql, stmt.args...)
+			if err != nil {
+				return nil, err
+			}
+			n, _ := res.RowsAffected()
+			total.rowsAffected += n
+			total.lastInsertId, _ = res.LastInsertId()
+		}
+		return total, nil
+	}
+
+	db, ok := t.db.(*database)
+	if !o.inTx || !ok || len(stmts) <= 1 {
+		return run(t.db)
+	}
+	err = db.RunInTx(ctx, nil, func(tx Tx) (err error) {
+		res, err = run(tx.(executor)) // a *tx created by the database
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func batchInsertSql(d Dialect, verb, name string, cols []string, values [][]interface{}) (sql string, args []interface{}) {
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = quoteColumn(d, c)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(verb + " " + name + "(" + strings.Join(quoted, ",") + ") values")
+
+	row := "(" + strings.TrimSuffix(strings.Repeat("?,", len(cols)), ",") + ")"
+	args = make([]interface{}, 0, len(cols)*len(values))
+	for i, vals := range values {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(row)
+		args = append(args, vals...)
+	}
+	return sb.String(), args
+}
+
+func (t *table) Upsert(obj interface{}, conflictCols, updateCols []string) (res sql.Result, err error) {
+	return t.UpsertContext(context.Background(), obj, conflictCols, updateCols)
+}
+
+func (t *table) UpsertContext(ctx context.Context, obj interface{}, conflictCols, updateCols []string) (res sql.Result, err error) {
+	if t.db == nil {
+		return nil, fmt.Errorf("db is not opened")
+	}
+
+	rows, ok := batchRows(obj)
+	if !ok {
+		// a single struct or map is upserted as a batch of one row
+		v := reflect.ValueOf(obj)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct && v.Kind() != reflect.Map {
+			return nil, fmt.Errorf("argument 1 is not a struct, map or slice of them")
+		}
+		rows = reflect.Append(reflect.MakeSlice(reflect.SliceOf(v.Type()), 0, 1), v)
+	}
+	return t.insertBatch(ctx, rows, &insertOptions{upsert: true, conflictCols: conflictCols, updateCols: updateCols})
+}
+
+// exclude returns the columns of cols which are not in ex.
+func exclude(cols, ex []string) (left []string) {
+	for _, c := range cols {
+		found := false
+		for _, e := range ex {
+			if c == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			left = append(left, c)
+		}
+	}
+	return left
+}
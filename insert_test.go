@@ -0,0 +1,196 @@
+package sorm
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInsertBatch(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("xx")
+
+	rows := make([]keyed, 5)
+	for i := range rows {
+		rows[i] = keyed{Name: "n", Dummy: "d"}
+	}
+	res, err := tb.Insert(&rows, BatchSize(2), BatchInTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra, _ := res.RowsAffected(); ra != 3 {
+		t.Errorf("RowsAffected()=%v, expect 3 (one per statement of the recorder)", ra)
+	}
+	if len(rec.sqls) != 5 || rec.sqls[0] != "BEGIN" || rec.sqls[4] != "COMMIT" {
+		t.Fatalf("got sqls %q", rec.sqls)
+	}
+	for i, n := range []int{2, 2, 1} {
+		query, args := rec.sqls[i+1], rec.args[i+1]
+		if strings.Contains(query, "id") || strings.Count(query, "(?,?)") != n || len(args) != 2*n {
+			t.Errorf("statement %v got %q %v", i, query, args)
+		}
+	}
+
+	// the rows are split by the placeholder limit, 999 on sqlite3
+	db2, rec2 := newRecorderDB("sqlite3", t)
+	defer db2.Close()
+	tb2, _ := db2.BindTable("xx")
+	maps := make([]map[string]interface{}, 700)
+	for i := range maps {
+		maps[i] = map[string]interface{}{"id": i, "name": "n", "dummy": "d"}
+	}
+	_, err = tb2.Insert(maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec2.sqls) != 3 || len(rec2.args[0]) != 999 || len(rec2.args[2]) != 3*(700-2*333) {
+		t.Errorf("got %v statements", len(rec2.sqls))
+	}
+
+	// pointers of struct, a non-zero autoincr field is inserted, and the rows
+	// leaving it to the database are inserted by another statement
+	rec.reset()
+	_, err = tb.Insert([]*keyed{{Name: "a"}, {Id: 3, Name: "b"}, {Name: "c"}, {Id: 4, Name: "d"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"insert into xx(`name`,`dummy`) values(?,?),(?,?)", "insert into xx(`id`,`name`,`dummy`) values(?,?,?),(?,?,?)"}
+	if !reflect.DeepEqual(rec.sqls, expect) {
+		t.Fatalf("got sqls %q", rec.sqls)
+	}
+	if !reflect.DeepEqual(rec.args[0], []driver.Value{"a", "", "c", ""}) || !reflect.DeepEqual(rec.args[1], []driver.Value{int64(3), "b", "", int64(4), "d", ""}) {
+		t.Errorf("got args %v", rec.args)
+	}
+
+	if _, err = tb.Insert([]map[string]interface{}{{"id": 1}, {"name": "x"}}); err == nil {
+		t.Errorf("rows with different columns should fail")
+	}
+	if _, err = tb.Insert([]*keyed{nil}); err == nil {
+		t.Errorf("nil row should fail")
+	}
+	if _, err = tb.Insert(&[]keyed{}); err == nil {
+		t.Errorf("empty rows should fail")
+	}
+}
+
+func TestSplitInsertOptions(t *testing.T) {
+	vals, o := splitInsertOptions([]interface{}{1, BatchSize(10), "x", BatchInTx()})
+	if !reflect.DeepEqual(vals, []interface{}{1, "x"}) || o.batchSize != 10 || !o.inTx {
+		t.Errorf("got %v %+v", vals, o)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	cases := []struct {
+		dbtype string
+		clause string
+	}{
+		{"mysql", "on duplicate key update `name`=values(`name`),`dummy`=values(`dummy`)"},
+		{"mysql8", "as new on duplicate key update `name`=new.`name`,`dummy`=new.`dummy`"},
+		{"postgres", `on conflict ("id") do update set "name"=excluded."name","dummy"=excluded."dummy"`},
+		{"sqlite3", `on conflict ("id") do update set "name"=excluded."name","dummy"=excluded."dummy"`},
+	}
+
+	for _, c := range cases {
+		db, rec := newRecorderDB(c.dbtype, t)
+		tb, _ := db.BindTable("xx")
+
+		// struct
+		_, err := tb.Upsert(&keyed{Id: 1, Name: "n", Dummy: "d"}, []string{"id"}, []string{"name", "dummy"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		query, args := rec.last()
+		if !strings.HasPrefix(query, "insert into xx(") || !strings.HasSuffix(query, ") "+c.clause) || len(args) != 3 {
+			t.Errorf("%v: got %q %v", c.dbtype, query, args)
+		}
+
+		// batch of maps, all but the conflict columns are updated
+		_, err = tb.Upsert([]map[string]interface{}{{"id": 1, "name": "a"}, {"id": 2, "name": "b"}}, []string{"id"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query, args = rec.last()
+		if strings.Count(query, "),(") != 1 || strings.Contains(query, "dummy") || len(args) != 4 {
+			t.Errorf("%v: got %q %v", c.dbtype, query, args)
+		}
+
+		if _, err = tb.Upsert(1, []string{"id"}, nil); err == nil {
+			t.Errorf("%v: upsert an int should fail", c.dbtype)
+		}
+		db.Close()
+	}
+
+	postgres := GetDialect("postgres").(UpsertDialect)
+	if _, err := postgres.Upsert(nil, []string{"name"}); err == nil {
+		t.Errorf("postgres upsert without conflict columns should fail")
+	}
+	if clause, _ := postgres.Upsert([]string{"id"}, nil); clause != `on conflict ("id") do nothing` {
+		t.Errorf("got %q", clause)
+	}
+	if clause, _ := GetDialect("mysql").(UpsertDialect).Upsert([]string{"id"}, nil); clause != "on duplicate key update `id`=`id`" {
+		t.Errorf("got %q", clause)
+	}
+}
+
+func TestInsertIgnore(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	tb, _ := db.BindTable("xx")
+
+	_, err := tb.Insert(1, "name1", "dummy1", IgnoreDuplicates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, args := rec.last(); query != "insert ignore into xx values(?,?,?)" || len(args) != 3 {
+		t.Errorf("got %q %v", query, args)
+	}
+
+	rec.affected = []int64{0}
+	res, err := tb.Insert(&map[string]interface{}{"id": 1}, IgnoreDuplicates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ra, _ := res.RowsAffected(); ra != 0 {
+		t.Errorf("RowsAffected()=%v, expect 0", ra)
+	}
+	if query, _ := rec.last(); query != "insert ignore into xx(`id`) values(?)" {
+		t.Errorf("got %q", query)
+	}
+
+	_, err = tb.Insert([]map[string]interface{}{{"id": 1}, {"id": 2}}, IgnoreDuplicates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert ignore into xx(`id`) values(?),(?)" {
+		t.Errorf("got %q", query)
+	}
+	db.Close()
+
+	db, rec = newRecorderDB("postgres", t)
+	defer db.Close()
+	tb, _ = db.BindTable("xx")
+
+	_, err = tb.Insert([]map[string]interface{}{{"id": 1}, {"id": 2}}, IgnoreDuplicates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into xx(\"id\") values($1),($2) on conflict do nothing" {
+		t.Errorf("got %q", query)
+	}
+
+	// the ignored row returns no id
+	k := &keyed{Name: "n", Dummy: "d"}
+	res, err = tb.Insert(k, IgnoreDuplicates())
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, _ := rec.last()
+	if !strings.HasSuffix(query, `) on conflict do nothing returning "id"`) {
+		t.Errorf("got %q", query)
+	}
+	if ra, _ := res.RowsAffected(); ra != 0 || k.Id != 0 {
+		t.Errorf("RowsAffected()=%v, id %v, expect 0", ra, k.Id)
+	}
+}
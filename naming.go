@@ -0,0 +1,85 @@
+package sorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy maps the name of a struct field to its column, and the name
+// of a struct type to its table, a column named by the fn tag is kept as it is.
+type NamingStrategy func(name string) string
+
+// LowerCase maps CreatedAt to "createdat", it's the default strategy.
+func LowerCase(name string) string {
+	return strings.ToLower(name)
+}
+
+// SnakeCase maps CreatedAt to "created_at", and UserID to "user_id".
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// a word starts at an upper case letter following a lower case
+			// one or a digit, or at the last upper case letter of an acronym
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) && runes[i-1] != '_' ||
+				i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])) {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// CamelCase maps CreatedAt to "createdAt", and IDCard to "idCard".
+func CamelCase(name string) string {
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsUpper(r) {
+			break
+		}
+		// keep the last upper case letter of an acronym followed by a word
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(r)
+	}
+	return string(runes)
+}
+
+// Identity maps a name to itself, CreatedAt to "CreatedAt".
+func Identity(name string) string {
+	return name
+}
+
+// tableNamer is implemented by a struct naming its own table, which is used by
+// BindStruct instead of the naming strategy.
+type tableNamer interface {
+	TableName() string
+}
+
+// tableName returns the table of a struct, a pointer of struct, or a slice of
+// them. A name returned by the TableName method is used as it is, the one
+// named by the naming strategy is quoted.
+func tableName(d Dialect, m *mapper, obj interface{}) (name string, err error) {
+	if tn, ok := obj.(tableNamer); ok {
+		return tn.TableName(), nil
+	}
+
+	t := reflect.TypeOf(obj)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || t.Name() == "" {
+		return "", fmt.Errorf("can not infer the table name of %T, a named struct is needed", obj)
+	}
+	if tn, ok := reflect.New(t).Interface().(tableNamer); ok {
+		// a slice of them
+		return tn.TableName(), nil
+	}
+	return d.Quote(m.naming(t.Name())), nil
+}
@@ -0,0 +1,213 @@
+package sorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+func TestNamingStrategy(t *testing.T) {
+	cases := []struct {
+		name                       string
+		lower, snake, camel, ident string
+	}{
+		{"CreatedAt", "createdat", "created_at", "createdAt", "CreatedAt"},
+		{"ID", "id", "id", "id", "ID"},
+		{"UserID", "userid", "user_id", "userID", "UserID"},
+		{"IDCard", "idcard", "id_card", "idCard", "IDCard"},
+		{"HTTPServer", "httpserver", "http_server", "httpServer", "HTTPServer"},
+		{"Line2Text", "line2text", "line2_text", "line2Text", "Line2Text"},
+		{"Foo_Bar", "foo_bar", "foo_bar", "foo_Bar", "Foo_Bar"},
+		{"name", "name", "name", "name", "name"},
+	}
+	for _, c := range cases {
+		if got := LowerCase(c.name); got != c.lower {
+			t.Errorf("LowerCase(%v) got %v, want %v", c.name, got, c.lower)
+		}
+		if got := SnakeCase(c.name); got != c.snake {
+			t.Errorf("SnakeCase(%v) got %v, want %v", c.name, got, c.snake)
+		}
+		if got := CamelCase(c.name); got != c.camel {
+			t.Errorf("CamelCase(%v) got %v, want %v", c.name, got, c.camel)
+		}
+		if got := Identity(c.name); got != c.ident {
+			t.Errorf("Identity(%v) got %v, want %v", c.name, got, c.ident)
+		}
+	}
+}
+
+type UserProfile struct {
+	UserID    int `sorm:"pk"`
+	NickName  string
+	CreatedAt string `sorm:"fn=ctime"`
+}
+
+type namedTable struct {
+	Id int
+}
+
+func (n *namedTable) TableName() string {
+	return "t_named"
+}
+
+func TestBindStruct(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+
+	for _, c := range []struct {
+		obj   interface{}
+		table string
+	}{
+		{UserProfile{}, "`userprofile`"},
+		{&UserProfile{}, "`userprofile`"},
+		{[]*UserProfile{}, "`userprofile`"},
+		{&namedTable{}, "t_named"},
+		{[]namedTable{}, "t_named"},
+	} {
+		tb, err := db.BindStruct(c.obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := tb.(*table).name; name != c.table {
+			t.Errorf("BindStruct(%T) got %v, want %v", c.obj, name, c.table)
+		}
+	}
+	if _, err := db.BindStruct(1); err == nil {
+		t.Error("BindStruct should fail on a non struct")
+	}
+	if _, err := db.BindStruct(struct{ A int }{}); err == nil {
+		t.Error("BindStruct should fail on an anonymous struct")
+	}
+
+	// the mapping is cached per strategy
+	db.SetNamingStrategy(SnakeCase)
+	tb, err := db.BindStruct(&UserProfile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tb.Insert(&UserProfile{UserID: 1, NickName: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into `user_profile`(`user_id`,`nick_name`,`ctime`) values(?,?,?)" {
+		t.Fatalf("Insert got %q", query)
+	}
+
+	rec.addRows([]driver.Value{"user_id", "nick_name", "ctime"}, []driver.Value{int64(2), "x", "t"})
+	var u UserProfile
+	err = tb.Get(&u, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != (UserProfile{2, "x", "t"}) {
+		t.Fatalf("Get got %+v", u)
+	}
+	if query, _ := rec.last(); query != "select * from `user_profile` where `user_id` = ? limit 1" {
+		t.Fatalf("Get got %q", query)
+	}
+
+	err = db.RunInTx(context.Background(), nil, func(tx Tx) error {
+		tb, _ := tx.BindStruct(&UserProfile{})
+		_, err := tb.Update("", &UserProfile{UserID: 1})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "COMMIT" || rec.sqls[len(rec.sqls)-2] != "update `user_profile` set `user_id`=?,`nick_name`=?,`ctime`=?" {
+		t.Fatalf("Update in tx got %v", rec.sqls)
+	}
+
+	db.SetNamingStrategy(nil)
+	tb, _ = db.BindStruct(&UserProfile{})
+	_, err = tb.Insert(&UserProfile{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into `userprofile`(`userid`,`nickname`,`ctime`) values(?,?,?)" {
+		t.Fatalf("Insert got %q", query)
+	}
+}
+
+func TestNamingQuoted(t *testing.T) {
+	db, rec := newRecorderDB("postgres", t)
+	defer db.Close()
+	db.SetNamingStrategy(CamelCase)
+	tb, _ := db.BindStruct(&UserProfile{})
+
+	// the columns of the writes match the ones of the keys
+	_, err := tb.Save(&UserProfile{UserID: 1, NickName: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != `update "userProfile" set "userID"=$1,"nickName"=$2,"ctime"=$3 where "userID" = $4` {
+		t.Fatalf("Save got %q", query)
+	}
+	_, err = tb.Upsert(&UserProfile{UserID: 1}, []string{"userID"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `insert into "userProfile"("userID","nickName","ctime") values($1,$2,$3) on conflict ("userID") do update set "nickName"=excluded."nickName","ctime"=excluded."ctime"`
+	if query, _ := rec.last(); query != expect {
+		t.Fatalf("Upsert got %q", query)
+	}
+}
+
+func TestSetNamingStrategy(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("xx")
+
+	// a table bound before follows the new strategy
+	db.SetNamingStrategy(SnakeCase)
+	_, err := tb.Insert(&UserProfile{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into xx(`user_id`,`nick_name`,`ctime`) values(?,?,?)" {
+		t.Fatalf("Insert got %q", query)
+	}
+
+	// a table bound by BindStruct keeps its name, its columns follow
+	db.SetNamingStrategy(LowerCase)
+	bound, _ := db.BindStruct(&UserProfile{})
+	db.SetNamingStrategy(SnakeCase)
+	_, err = bound.Insert(&UserProfile{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into `userprofile`(`user_id`,`nick_name`,`ctime`) values(?,?,?)" {
+		t.Fatalf("Insert got %q", query)
+	}
+
+	bound, _ = db.BindStruct(&UserProfile{})
+	_, err = bound.Insert(&UserProfile{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into `user_profile`(`user_id`,`nick_name`,`ctime`) values(?,?,?)" {
+		t.Fatalf("Insert got %q after binding", query)
+	}
+
+	// safe along with the statements
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 100; i++ {
+			if _, err := tb.Insert(&UserProfile{UserID: i}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			db.SetNamingStrategy(CamelCase)
+		} else {
+			db.SetNamingStrategy(SnakeCase)
+		}
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,16 +1,22 @@
 package sorm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 )
 
 type query struct {
-	sql  string
-	stmt *sql.Stmt
+	sql    string
+	stmt   *sql.Stmt
+	mapper *mapper // maps the struct receivers of the result
 }
 
 func (q *query) Exec(args ...interface{}) (res Result, err error) {
+	return q.ExecContext(context.Background(), args...)
+}
+
+func (q *query) ExecContext(ctx context.Context, args ...interface{}) (res Result, err error) {
 	if q.stmt == nil {
 		return nil, fmt.Errorf("query is not initialized")
 	}
@@ -18,12 +24,12 @@ func (q *query) Exec(args ...interface{}) (res Result, err error) {
 	if printSql {
 		fmt.Printf("Query.Exec: %v, args %v\n", q.sql, args)
 	}
-	rows, err := q.stmt.Query(args...)
+	rows, err := q.stmt.QueryContext(ctx, args...)
 	if err != nil {
-		return nil, err
+		return nil, ctxErr(ctx, err)
 	}
 
-	res = &result{rows: rows}
+	res = &result{rows: rows, mapper: q.mapper}
 	return res, nil
 }
 
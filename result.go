@@ -8,8 +8,10 @@ import (
 )
 
 type result struct {
-	rows *sql.Rows
-	cols []string
+	rows   *sql.Rows
+	cols   []string
+	mapper *mapper // maps the struct receivers
+	query  Query   // the statement owned by the result, closed along with the rows
 }
 
 func (r *result) Next(obj interface{}, args ...interface{}) (err error) {
@@ -24,7 +26,7 @@ func (r *result) Next(obj interface{}, args ...interface{}) (err error) {
 	}
 
 	if r.rows.Next() {
-		scanArgs, err := getFieldsForOne(obj, args, r.cols)
+		scanArgs, err := r.mapper.getFieldsForOne(obj, args, r.cols)
 		if err != nil {
 			return err
 		}
@@ -32,9 +34,15 @@ func (r *result) Next(obj interface{}, args ...interface{}) (err error) {
 			return fmt.Errorf("no receiver found")
 		}
 
-		return r.rows.Scan(scanArgs...)
+		return scanRow(r.rows, scanArgs)
 	} else {
+		// the rows may stop by an error, such as a canceled context
+		err = r.rows.Err()
 		r.rows.Close()
+		r.closeQuery()
+		if err != nil {
+			return err
+		}
 		return io.EOF
 	}
 }
@@ -54,6 +62,7 @@ func (r *result) All(objs interface{}) (err error) {
 	if err != nil {
 		return err
 	}
+	defer r.closeQuery()
 	defer r.rows.Close()
 
 	var scanArgs []interface{}
@@ -61,7 +70,7 @@ func (r *result) All(objs interface{}) (err error) {
 	etyp := sInd.Type().Elem()
 	if etyp.Kind() == reflect.Struct {
 		ind = reflect.New(sInd.Type().Elem()).Elem()
-		scanArgs = getScanFieldFromStruct(ind, cols)
+		scanArgs = r.mapper.getScanFieldFromStruct(ind, cols)
 		if scanArgs == nil {
 			return fmt.Errorf("no receiver found")
 		}
@@ -76,8 +85,14 @@ func (r *result) All(objs interface{}) (err error) {
 
 	sIndCopy := sInd
 	err = io.EOF
-	for r.rows.Next() {
-		err = r.rows.Scan(scanArgs...)
+	for first := true; r.rows.Next(); first = false {
+		if etyp.Kind() == reflect.Struct && !first {
+			// a fresh struct per row, the pointers allocated by the scan are
+			// not shared by the rows
+			ind = reflect.New(etyp).Elem()
+			scanArgs = r.mapper.getScanFieldFromStruct(ind, cols)
+		}
+		err = scanRow(r.rows, scanArgs)
 		if err != nil {
 			break
 		}
@@ -85,6 +100,13 @@ func (r *result) All(objs interface{}) (err error) {
 		sIndCopy = reflect.Append(sIndCopy, ind)
 	}
 
+	if err == nil || err == io.EOF {
+		// the rows may stop by an error, such as a canceled context
+		if rerr := r.rows.Err(); rerr != nil {
+			err = rerr
+		}
+	}
+
 	// ret may take back some records, even though there is an error.
 	sInd.Set(sIndCopy)
 	return err
@@ -112,5 +134,15 @@ func (r *result) Close() (err error) {
 		r.rows = nil
 	}
 	r.cols = nil
+	r.closeQuery()
 	return err
 }
+
+// closeQuery closes the statement owned by the result, it must be called
+// after the rows are closed.
+func (r *result) closeQuery() {
+	if r.query != nil {
+		r.query.Close()
+		r.query = nil
+	}
+}
@@ -0,0 +1,301 @@
+package sorm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type join struct {
+	kind  string // join, left join or right join
+	table string // such as "orders o"
+	on    Cond
+}
+
+type cte struct {
+	name  string // such as "t" or "t(n)"
+	query Cond
+}
+
+type selector struct {
+	t         *table
+	ctes      []cte
+	recursive bool
+	from      builder // a derived table replacing the table
+	alias     string
+	cols      []string
+	joins     []join
+	where     []Cond
+	groupBy   []string
+	having    []Cond
+	orderBy   []string
+	limit     int
+	offset    int
+	err       error // the first error of the chained calls, reported by ToSQL
+}
+
+func (t *table) Select(cols ...string) Selector {
+	return &selector{t: t, cols: cols}
+}
+
+func (s *selector) With(name string, query interface{}, args ...interface{}) Selector {
+	return s.with(name, query, args)
+}
+
+func (s *selector) WithRecursive(name string, query interface{}, args ...interface{}) Selector {
+	s.recursive = true
+	return s.with(name, query, args)
+}
+
+func (s *selector) with(name string, query interface{}, args []interface{}) Selector {
+	var c Cond
+	if sub, ok := query.(builder); ok && len(args) == 0 {
+		c = &subCond{sub}
+	} else if q, ok := query.(string); ok && q != "" {
+		c = Raw(q, args...)
+	} else if s.err == nil {
+		s.err = fmt.Errorf("the query of cte %v must be a Selector, or a string with args", name)
+	}
+	if c != nil {
+		s.ctes = append(s.ctes, cte{name: name, query: c})
+	}
+	return s
+}
+
+func (s *selector) From(sub Selector, alias string) Selector {
+	b, ok := sub.(builder)
+	if !ok || alias == "" {
+		if s.err == nil {
+			s.err = fmt.Errorf("from needs a Selector created by Table.Select and an alias")
+		}
+		return s
+	}
+	s.from = b
+	s.alias = alias
+	return s
+}
+
+func (s *selector) As(alias string) Selector {
+	s.alias = alias
+	return s
+}
+
+func (s *selector) Join(table string, on interface{}, args ...interface{}) Selector {
+	return s.join("join", table, on, args)
+}
+
+func (s *selector) LeftJoin(table string, on interface{}, args ...interface{}) Selector {
+	return s.join("left join", table, on, args)
+}
+
+func (s *selector) RightJoin(table string, on interface{}, args ...interface{}) Selector {
+	return s.join("right join", table, on, args)
+}
+
+func (s *selector) join(kind, table string, on interface{}, args []interface{}) Selector {
+	conds := s.appendCond(nil, on, args)
+	if len(conds) == 0 {
+		if s.err == nil {
+			s.err = fmt.Errorf("%v %v must have an on condition", kind, table)
+		}
+		return s
+	}
+	s.joins = append(s.joins, join{kind: kind, table: table, on: conds[0]})
+	return s
+}
+
+func (s *selector) Where(filter interface{}, args ...interface{}) Selector {
+	s.where = s.appendCond(s.where, filter, args)
+	return s
+}
+
+func (s *selector) GroupBy(cols ...string) Selector {
+	s.groupBy = append(s.groupBy, cols...)
+	return s
+}
+
+func (s *selector) Having(filter interface{}, args ...interface{}) Selector {
+	s.having = s.appendCond(s.having, filter, args)
+	return s
+}
+
+func (s *selector) OrderBy(cols ...string) Selector {
+	s.orderBy = append(s.orderBy, cols...)
+	return s
+}
+
+func (s *selector) Limit(n int) Selector {
+	s.limit = n
+	return s
+}
+
+func (s *selector) Offset(n int) Selector {
+	s.offset = n
+	return s
+}
+
+func (s *selector) appendCond(conds []Cond, filter interface{}, args []interface{}) []Cond {
+	cond, err := toCond(filter, args)
+	if err != nil {
+		if s.err == nil {
+			s.err = err
+		}
+		return conds
+	}
+	if cond == nil {
+		return conds
+	}
+	return append(conds, cond)
+}
+
+func (s *selector) ToSQL() (sql string, args []interface{}, err error) {
+	sql, args, err = s.build()
+	if err != nil {
+		return "", nil, err
+	}
+	return Rebind(s.t.db.Dialect().BindType(), sql), args, nil
+}
+
+// build renders the statement with "?" placeholders.
+func (s *selector) build() (sql string, args []interface{}, err error) {
+	if s.err != nil {
+		return "", nil, s.err
+	}
+	d := s.t.db.Dialect()
+
+	var sb strings.Builder
+	for i, c := range s.ctes {
+		if i == 0 {
+			sb.WriteString("with ")
+			if s.recursive {
+				sb.WriteString("recursive ")
+			}
+		} else {
+			sb.WriteString(", ")
+		}
+		query, queryArgs, err := c.query.ToSQL(d)
+		if err != nil {
+			return "", nil, err
+		}
+		sb.WriteString(c.name + " as (" + query + ") ")
+		args = append(args, queryArgs...)
+	}
+
+	sb.WriteString("select ")
+	if len(s.cols) == 0 {
+		sb.WriteString("*")
+	} else if len(s.joins) > 0 {
+		sb.WriteString(selectColumns(d, s.cols))
+	} else {
+		sb.WriteString(joinColumns(d, s.cols))
+	}
+	sb.WriteString(" from ")
+	if s.from != nil {
+		from, fromArgs, err := s.from.build()
+		if err != nil {
+			return "", nil, err
+		}
+		sb.WriteString("(" + from + ")")
+		args = append(args, fromArgs...)
+	} else {
+		sb.WriteString(s.t.name)
+	}
+	if s.alias != "" {
+		sb.WriteString(" ")
+		sb.WriteString(s.alias)
+	}
+
+	for _, j := range s.joins {
+		on, onArgs, err := j.on.ToSQL(d)
+		if err != nil {
+			return "", nil, err
+		}
+		sb.WriteString(" " + j.kind + " " + j.table + " on " + on)
+		args = append(args, onArgs...)
+	}
+
+	where, whereArgs, err := And(s.where...).ToSQL(d)
+	if err != nil {
+		return "", nil, err
+	}
+	if where != "" {
+		sb.WriteString(" where ")
+		sb.WriteString(where)
+		args = append(args, whereArgs...)
+	}
+
+	if len(s.groupBy) > 0 {
+		sb.WriteString(" group by ")
+		sb.WriteString(joinColumns(d, s.groupBy))
+	}
+
+	having, havingArgs, err := And(s.having...).ToSQL(d)
+	if err != nil {
+		return "", nil, err
+	}
+	if having != "" {
+		sb.WriteString(" having ")
+		sb.WriteString(having)
+		args = append(args, havingArgs...)
+	}
+
+	if len(s.orderBy) > 0 {
+		sb.WriteString(" order by ")
+		sb.WriteString(joinColumns(d, s.orderBy))
+	}
+
+	if limit := d.Limit(s.limit, s.offset); limit != "" {
+		sb.WriteString(" ")
+		sb.WriteString(limit)
+	}
+	return sb.String(), args, nil
+}
+
+func (s *selector) Exec() (res Result, err error) {
+	return s.ExecContext(context.Background())
+}
+
+func (s *selector) ExecContext(ctx context.Context) (res Result, err error) {
+	if s.t.db == nil {
+		return nil, fmt.Errorf("db is not opened")
+	}
+
+	sql, args, err := s.build()
+	if err != nil {
+		return nil, err
+	}
+	return queryOnce(ctx, s.t.db, sql, args)
+}
+
+// subCond renders a Selector as it is, for the query of a cte.
+type subCond struct {
+	sub builder
+}
+
+func (c *subCond) ToSQL(d Dialect) (sql string, args []interface{}, err error) {
+	return c.sub.build()
+}
+
+// selectColumns renders the select list of a joined query, a qualified column
+// such as "u.id" is aliased by its qualified name, so that it can be received
+// by a nested struct tagged by `sorm:"table=u"`.
+func selectColumns(d Dialect, cols []string) string {
+	rendered := make([]string, len(cols))
+	for i, c := range cols {
+		c = strings.TrimSpace(c)
+		rendered[i] = quoteColumn(d, c)
+		if strings.Contains(c, ".") && rendered[i] != c {
+			rendered[i] += " as " + d.Quote(c)
+		}
+	}
+	return strings.Join(rendered, ", ")
+}
+
+// joinColumns quotes the plain column names and joins them by comma.
+func joinColumns(d Dialect, cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = quoteColumn(d, strings.TrimSpace(c))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,215 @@
+package sorm
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestSelectToSQL(t *testing.T) {
+	cases := []struct {
+		dbtype string
+		sel    func(tb Table) Selector
+		sql    string
+		args   []interface{}
+	}{
+		{"mysql", func(tb Table) Selector { return tb.Select() }, "select * from xx", nil},
+		{"mysql", func(tb Table) Selector {
+			return tb.Select("id", "name").Where("id>?", 1).Where(Like("name", "a%")).OrderBy("id desc").Limit(10).Offset(20)
+		}, "select `id`, `name` from xx where (id>? and `name` like ?) order by id desc limit 10 offset 20", []interface{}{1, "a%"}},
+		{"postgres", func(tb Table) Selector {
+			return tb.Select("dummy", "count(*) as n").Where(Gt("id", 1)).GroupBy("dummy").Having("count(*)>?", 2).OrderBy("n")
+		}, `select "dummy", count(*) as n from xx where "id" > $1 group by "dummy" having count(*)>$2 order by "n"`, []interface{}{1, 2}},
+		{"sqlite3", func(tb Table) Selector { return tb.Select().Offset(5) }, "select * from xx limit -1 offset 5", nil},
+	}
+
+	for _, c := range cases {
+		db, _ := newRecorderDB(c.dbtype, t)
+		tb, err := db.BindTable("xx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sql, args, err := c.sel(tb).ToSQL()
+		if err != nil {
+			t.Errorf("%q: %v", c.sql, err)
+		} else if sql != c.sql || !reflect.DeepEqual(args, c.args) {
+			t.Errorf("got %q %v, expect %q %v", sql, args, c.sql, c.args)
+		}
+		db.Close()
+	}
+}
+
+func TestSelectExec(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+
+	tb, err := db.BindTable("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.addRows([]driver.Value{"id", "dummy"}, []driver.Value{int64(1), "dummy1"}, []driver.Value{int64(2), "dummy2"})
+
+	res, err := tb.Select("id", "dummy").Where(In("id", 1, 2)).OrderBy("id").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []tbs
+	err = res.All(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1].SId != 2 || rows[1].Dummy != "dummy2" {
+		t.Errorf("got rows %v", rows)
+	}
+	sql, args := rec.last()
+	if sql != "select `id`, `dummy` from xx where `id` in (?,?) order by `id`" || len(args) != 2 {
+		t.Errorf("got %q %v", sql, args)
+	}
+
+	if _, err = tb.Select().Where(1).Exec(); err == nil {
+		t.Errorf("Where with an int filter should fail")
+	}
+}
+
+type joinUser struct {
+	Id   int
+	Name string
+}
+
+type joinOrder struct {
+	Id     int
+	Amount int
+}
+
+type userOrder struct {
+	User  joinUser  `sorm:"table=u"`
+	Order joinOrder `sorm:"table=o"`
+	Total int
+}
+
+func TestSelectJoin(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+
+	tb, err := db.BindTable("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sel := tb.Select("u.id", "u.name", "o.id", "o.amount", "count(*) as total").As("u").
+		Join("orders o", "o.uid = u.id and o.amount > ?", 10).
+		LeftJoin("items i", Raw("i.oid = o.id")).
+		Where(Eq("u.name", "x")).GroupBy("u.id", "o.id")
+	sql, args, err := sel.ToSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "select `u`.`id` as `u.id`, `u`.`name` as `u.name`, `o`.`id` as `o.id`, `o`.`amount` as `o.amount`, count(*) as total" +
+		" from users u join orders o on o.uid = u.id and o.amount > ? left join items i on i.oid = o.id" +
+		" where `u`.`name` = ? group by `u`.`id`, `o`.`id`"
+	if sql != expect || !reflect.DeepEqual(args, []interface{}{10, "x"}) {
+		t.Errorf("got %q %v, expect %q", sql, args, expect)
+	}
+
+	rec.addRows([]driver.Value{"u.id", "u.name", "o.id", "o.amount", "total"},
+		[]driver.Value{int64(1), "x", int64(7), int64(20), int64(3)})
+	res, err := sel.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []userOrder
+	err = res.All(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRow := userOrder{User: joinUser{1, "x"}, Order: joinOrder{7, 20}, Total: 3}
+	if len(rows) != 1 || rows[0] != expectRow {
+		t.Errorf("got rows %+v, expect %+v", rows, expectRow)
+	}
+
+	// a qualified column falls back to the plain field
+	rec.addRows([]driver.Value{"u.id", "o.dummy"}, []driver.Value{int64(1), "dummy1"})
+	res, err = tb.Select("u.id", "o.dummy").As("u").Join("xx o", "o.id = u.id").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &tbs{}
+	err = res.Next(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.SId != 1 || r.Dummy != "dummy1" {
+		t.Errorf("got %+v", r)
+	}
+	res.Close()
+
+	if _, _, err = tb.Select().Join("orders o", "").ToSQL(); err == nil {
+		t.Errorf("Join without on condition should fail")
+	}
+}
+
+func TestSelectSubquery(t *testing.T) {
+	db, _ := newRecorderDB("postgres", t)
+	defer db.Close()
+
+	users, _ := db.BindTable("users")
+	orders, _ := db.BindTable("orders")
+
+	// the placeholders are numbered in the order of the rendered sql
+	sel := users.Select("id", "name").
+		Where(Gt("age", 18)).
+		Where(In("id", orders.Select("uid").Where(Gt("amount", 100)))).
+		Where(Exists(orders.Select("1").As("o").Where("o.uid = users.id and o.state = ?", "paid"))).
+		Where(Ne("score", orders.Select("max(amount)")))
+	sql, args, err := sel.ToSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `select "id", "name" from users where ("age" > $1 and "id" in (select "uid" from orders where "amount" > $2)` +
+		` and exists (select 1 from orders o where o.uid = users.id and o.state = $3)` +
+		` and "score" <> (select max(amount) from orders))`
+	if sql != expect || !reflect.DeepEqual(args, []interface{}{18, 100, "paid"}) {
+		t.Errorf("got %q %v, expect %q", sql, args, expect)
+	}
+
+	// derived table
+	sel = orders.Select("t.uid", "t.n").From(orders.Select("uid", "count(*) as n").Where(Gt("amount", 1)).GroupBy("uid"), "t").Where(Gt("t.n", 2))
+	sql, args, err = sel.ToSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `select "t"."uid", "t"."n" from (select "uid", count(*) as n from orders where "amount" > $1 group by "uid") t where "t"."n" > $2`
+	if sql != expect || !reflect.DeepEqual(args, []interface{}{1, 2}) {
+		t.Errorf("got %q %v, expect %q", sql, args, expect)
+	}
+
+	// cte
+	big, _ := db.BindTable("big")
+	sel = big.Select().With("big", orders.Select("uid").Where(Gt("amount", 100))).Where(NotIn("uid", 1))
+	sql, args, err = sel.ToSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `with big as (select "uid" from orders where "amount" > $1) select * from big where "uid" not in ($2)`
+	if sql != expect || !reflect.DeepEqual(args, []interface{}{100, 1}) {
+		t.Errorf("got %q %v, expect %q", sql, args, expect)
+	}
+
+	seq, _ := db.BindTable("seq")
+	sel = seq.Select("n").WithRecursive("seq(n)", "select 1 union all select n+1 from seq where n < ?", 10).Where(Gt("n", 5))
+	sql, args, err = sel.ToSQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `with recursive seq(n) as (select 1 union all select n+1 from seq where n < $1) select "n" from seq where "n" > $2`
+	if sql != expect || !reflect.DeepEqual(args, []interface{}{10, 5}) {
+		t.Errorf("got %q %v, expect %q", sql, args, expect)
+	}
+
+	if _, _, err = seq.Select().With("x", 1).ToSQL(); err == nil {
+		t.Errorf("With an int query should fail")
+	}
+	if _, _, err = seq.Select().From(seq.Select(), "").ToSQL(); err == nil {
+		t.Errorf("From without alias should fail")
+	}
+}
@@ -1,7 +1,9 @@
 package sorm
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"time"
 )
@@ -12,64 +14,284 @@ func PrintSql(yes bool) {
 	printSql = yes
 }
 
-//
+// NewDatabase opens a database, dbtype is the name of a registered dialect,
+// such as "mysql", "sqlite3" or "postgres". It prints the error and returns nil
+// on failure, use Open to get the error instead.
 func NewDatabase(dbtype, conn string) (db Database) {
-	switch dbtype {
-	case "mysql":
-		d := &database{}
-		d.dbtype = dbtype
-		err := d.open(conn)
-		if err != nil {
-			fmt.Printf("sorm create database connection failed:%v\n", err)
-			return nil
-		}
-		return d
-	default:
-		fmt.Printf("sorm create database connection failed: unsurpported dbtype %v\n", dbtype)
+	db, err := Open(dbtype, conn)
+	if err != nil {
+		fmt.Printf("sorm create database connection failed:%v\n", err)
 		return nil
 	}
+	return db
+}
+
+// Option configures the database created by Open.
+type Option func(*options)
+
+type options struct {
+	skipPing bool
+}
+
+// SkipPing makes Open return without connecting to the database, the first
+// connection is made by the first statement.
+func SkipPing() Option {
+	return func(o *options) {
+		o.skipPing = true
+	}
+}
+
+// Open opens a database, dbtype is the name of a registered dialect, such as
+// "mysql", "sqlite3" or "postgres". The database is pinged unless SkipPing is
+// given, the error is ErrUnsupportedDialect, ErrInvalidDSN, a *PingError or the
+// error returned by sql.Open.
+func Open(dbtype, conn string, opts ...Option) (db Database, err error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	dialect := GetDialect(dbtype)
+	if dialect == nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedDialect, dbtype)
+	}
+
+	d := &database{dialect: dialect}
+	err = d.open(conn, !o.skipPing)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// OpenDB wraps an opened *sql.DB, dbtype is the name of a registered dialect.
+// The pool is used as it is, and closing the Database closes the pool too.
+func OpenDB(dbtype string, sqldb *sql.DB) (db Database, err error) {
+	dialect := GetDialect(dbtype)
+	if dialect == nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedDialect, dbtype)
+	}
+	if sqldb == nil {
+		return nil, fmt.Errorf("invalid sql.DB")
+	}
+	return &database{dialect: dialect, db: sqldb}, nil
+}
+
+// OpenConnector opens a database using a driver.Connector, the connections are
+// created lazily as sql.OpenDB does.
+func OpenConnector(dbtype string, c driver.Connector) (db Database, err error) {
+	if c == nil {
+		return nil, fmt.Errorf("invalid driver connector")
+	}
+	return OpenDB(dbtype, sql.OpenDB(c))
 }
 
 type Database interface {
 	Exec(sql string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error)
 	Close() error
 
 	BindTable(tn string) (Table, error)
+	// bind the table of a struct, named by its TableName method if it has
+	// one, or by the current naming strategy from the type name
+	BindStruct(obj interface{}) (Table, error)
 	CreateQuery(sql string) (Query, error)
+	CreateQueryContext(ctx context.Context, sql string) (Query, error)
+
+	// start a transaction, the tables and queries created by the Tx run in it
+	Begin() (Tx, error)
+	BeginTx(ctx context.Context, opts *TxOptions) (Tx, error)
+	// run fn in a transaction, which is committed if fn returns nil, or rolled
+	// back if fn returns an error or panics, opts can be nil
+	RunInTx(ctx context.Context, opts *TxOptions, fn func(tx Tx) error) error
 
 	SetConnMaxLifetime(d time.Duration)
 	SetMaxIdleConns(n int)
 	SetMaxOpenConns(n int)
+	// how the struct fields and types are mapped to the columns and tables,
+	// LowerCase by default, the columns of the tables bound before follow it,
+	// but not the names of the ones bound by BindStruct, nor the transactions
+	// already begun
+	SetNamingStrategy(ns NamingStrategy)
+
+	Dialect() Dialect
+	// the underlying connection pool, nil if the database is closed
+	DB() *sql.DB
 }
 
-type Table interface {
-	// Refactor the methods as below?
-	// type Filter map[string]interface{}
-	//Query(obj, filter)
-	//Delete(obj, filter)
-	//Update(obj, filter)
+// Dialect hides the syntax differences between the databases. The optional
+// features are declared by the smaller interfaces below, a dialect without
+// them behaves as the built-in ones by default.
+type Dialect interface {
+	Name() string
+	// the driver name passed to sql.Open
+	DriverName() string
+	// placeholder style of the bind parameters
+	BindType() BindType
+	// quote an identifier, such as a table or column name
+	Quote(ident string) string
+	// limit and offset clause, a non-positive value means not set
+	Limit(limit, offset int) string
+	// how to read back the id generated by an insert
+	InsertIdStrategy() InsertIdStrategy
+}
+
+// RetryDialect tells whether a transaction failed by err is worth a retry,
+// such as a deadlock, nothing is retried without it.
+type RetryDialect interface {
+	IsRetryable(err error) bool
+}
 
-	// will insert by the column order
+// SavepointDialect renders the statements to create, release and roll back to
+// a savepoint, the sql standard ones are used without it.
+type SavepointDialect interface {
+	Savepoint(name string) string
+	ReleaseSavepoint(name string) string
+	RollbackToSavepoint(name string) string
+}
+
+// BatchDialect limits the placeholders of a statement, 65535 without it.
+type BatchDialect interface {
+	MaxBindVars() int
+}
+
+// InsertIgnoreDialect renders the verb and the suffix of an insert skipping
+// the conflicting rows, "on conflict do nothing" is used without it.
+type InsertIgnoreDialect interface {
+	InsertIgnore() (verb, suffix string)
+}
+
+// UpsertDialect renders the clause appended to an insert to update the
+// conflicting row, "on conflict (...) do update" is used without it.
+type UpsertDialect interface {
+	Upsert(conflictCols, updateCols []string) (string, error)
+}
+
+// Tx is a transaction, it must be ended by Commit or Rollback.
+type Tx interface {
+	Exec(sql string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error)
+	BindTable(tn string) (Table, error)
+	BindStruct(obj interface{}) (Table, error)
+	CreateQuery(sql string) (Query, error)
+	CreateQueryContext(ctx context.Context, sql string) (Query, error)
+
+	Commit() error
+	Rollback() error
+	// run fn in a nested transaction created by a savepoint, which is released
+	// if fn returns nil, or rolled back to if fn returns an error or panics
+	RunInTx(ctx context.Context, opts *TxOptions, fn func(tx Tx) error) error
+
+	Dialect() Dialect
+}
+
+// Cond is a condition of the where clause, such as Eq("id", 1), the sql is
+// rendered with "?" placeholders which are rebound when executed.
+type Cond interface {
+	ToSQL(d Dialect) (sql string, args []interface{}, err error)
+}
+
+// The filter of the Table methods is the where clause, it's a Cond, or a
+// string with args bound to its placeholders, such as "id=? and name=?".
+type Table interface {
+	// will insert by the column order, for a pointer of struct, a zero field
+	// tagged by autoincr is left to the database, and the generated id is
+	// written back into it. A zero field tagged by omitempty and the fields
+	// tagged by readonly are not inserted.
+	// A slice or pointer of slice of structs or maps is inserted by multi-row
+	// statements, the InsertOption values such as BatchSize and
+	// IgnoreDuplicates can be passed along
 	Insert(values ...interface{}) (sql.Result, error)
+	InsertContext(ctx context.Context, values ...interface{}) (sql.Result, error)
 	// will only insert the columns the table has
 	//Insert(value map[string]interface{})
 	//Insert(value struct)
 
-	Delete(filter string) (sql.Result, error)
+	Delete(filter interface{}, args ...interface{}) (sql.Result, error)
+	DeleteContext(ctx context.Context, filter interface{}, args ...interface{}) (sql.Result, error)
 
-	Update(filter string, value interface{}) (sql.Result, error)
+	// filterArgs are bound after the values of the set clause, a zero field
+	// tagged by omitempty and the fields tagged by readonly or insertonly are
+	// not updated
+	Update(filter interface{}, value interface{}, filterArgs ...interface{}) (sql.Result, error)
+	UpdateContext(ctx context.Context, filter interface{}, value interface{}, filterArgs ...interface{}) (sql.Result, error)
 	//Update(filter string, value map[string]interface{})
 	//Update(filter string, value struct)
 
 	// will select all columns
-	Query(filter string) (Result, error)
+	Query(filter interface{}, args ...interface{}) (Result, error)
+	QueryContext(ctx context.Context, filter interface{}, args ...interface{}) (Result, error)
+
+	// insert the struct, map or slice of them, and update the updateCols of
+	// the row conflicting on conflictCols, all the inserted columns but the
+	// conflict and insertonly ones are updated if updateCols is empty. The
+	// generated ids are not written back
+	Upsert(obj interface{}, conflictCols, updateCols []string) (sql.Result, error)
+	UpsertContext(ctx context.Context, obj interface{}, conflictCols, updateCols []string) (sql.Result, error)
+
+	// the methods below need the primary key fields tagged by pk, such as
+	// `sorm:"fn=id;pk;autoincr"`
+
+	// load the row of the keys into ptr, the keys are in the order of the pk
+	// fields, or taken from ptr if empty, sql.ErrNoRows if not found
+	Get(ptr interface{}, keys ...interface{}) error
+	GetContext(ctx context.Context, ptr interface{}, keys ...interface{}) error
+	// insert ptr if the autoincr key is zero or the row does not exist,
+	// otherwise update the row by the keys
+	Save(ptr interface{}) (sql.Result, error)
+	SaveContext(ctx context.Context, ptr interface{}) (sql.Result, error)
+	// delete the row by the keys of ptr
+	DeleteByKey(ptr interface{}) (sql.Result, error)
+	DeleteByKeyContext(ctx context.Context, ptr interface{}) (sql.Result, error)
+
+	// build a select statement of the table, all columns are selected if cols
+	// is empty, such as Select("id", "name").Where(Gt("id", 1)).Limit(10)
+	Select(cols ...string) Selector
 
 	//Drop() error
 }
 
+// Selector is a chainable select statement, the errors of the chained calls
+// are reported by ToSQL or Exec.
+type Selector interface {
+	// common table expressions, the query is a Selector, or a string with
+	// args bound to its placeholders, such as With("t", tb.Select("id")) or
+	// WithRecursive("t(n)", "select 1 union all select n+1 from t where n<?", 10),
+	// the name is then used by a join, a subquery or Table.Select
+	With(name string, query interface{}, args ...interface{}) Selector
+	WithRecursive(name string, query interface{}, args ...interface{}) Selector
+	// select from a derived table instead of the table, such as
+	// From(tb.Select("dummy", "count(*) as n").GroupBy("dummy"), "t")
+	From(sub Selector, alias string) Selector
+	// alias of the table, such as Select("u.id", "o.id").As("u")
+	As(alias string) Selector
+	// join a table with an alias, such as Join("orders o", "o.uid = u.id"), the
+	// on condition is a Cond, or a string with args bound to its placeholders.
+	// A qualified column such as "o.id" is selected as "o.id", and is received
+	// by a nested struct field tagged by `sorm:"table=o"`.
+	Join(table string, on interface{}, args ...interface{}) Selector
+	LeftJoin(table string, on interface{}, args ...interface{}) Selector
+	RightJoin(table string, on interface{}, args ...interface{}) Selector
+	// the where conditions are joined by "and", the filter is the same as the
+	// one of the Table methods
+	Where(filter interface{}, args ...interface{}) Selector
+	GroupBy(cols ...string) Selector
+	Having(filter interface{}, args ...interface{}) Selector
+	// such as OrderBy("id desc", "name")
+	OrderBy(cols ...string) Selector
+	Limit(n int) Selector
+	Offset(n int) Selector
+
+	// the sql with the placeholders of the dialect
+	ToSQL() (sql string, args []interface{}, err error)
+	Exec() (Result, error)
+	ExecContext(ctx context.Context) (Result, error)
+}
+
 type Query interface {
 	// need first call Exec
 	Exec(args ...interface{}) (res Result, err error)
+	ExecContext(ctx context.Context, args ...interface{}) (res Result, err error)
 	Close() error
 }
 
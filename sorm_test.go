@@ -1,6 +1,14 @@
 package sorm
 
-import _ "github.com/go-sql-driver/mysql"
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+)
 
 type tbs struct {
 	SId   int    `sorm:"fn=id"`
@@ -15,3 +23,148 @@ const (
 func init() {
 	PrintSql(false)
 }
+
+// recorder is a fake driver.Connector which records the statements it runs,
+// it lets the tests check the generated sql without a real database.
+type recorder struct {
+	mu       sync.Mutex
+	sqls     []string
+	args     [][]driver.Value
+	results  [][][]driver.Value // rows returned by the next queries, the first row is the column names
+	lastId   int64
+	affected []int64 // rows affected by the next execs, 1 if empty
+	err      error   // returned by the next statement
+	prepares int     // statements prepared
+	closes   int     // statements closed
+}
+
+func newRecorderDB(dbtype string, t *testing.T) (Database, *recorder) {
+	rec := &recorder{}
+	db, err := OpenConnector(dbtype, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, rec
+}
+
+// addRows queues the result of a query, the first row holds the column names.
+func (r *recorder) addRows(rows ...[]driver.Value) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, rows)
+}
+
+func (r *recorder) record(query string, args []driver.Value) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sqls = append(r.sqls, query)
+	r.args = append(r.args, args)
+	err := r.err
+	r.err = nil
+	return err
+}
+
+func (r *recorder) last() (string, []driver.Value) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.sqls) == 0 {
+		return "", nil
+	}
+	return r.sqls[len(r.sqls)-1], r.args[len(r.args)-1]
+}
+
+func (r *recorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sqls, r.args, r.results, r.affected = nil, nil, nil, nil
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) { return &recorderConn{r}, nil }
+func (r *recorder) Driver() driver.Driver                        { return nil }
+
+type recorderConn struct {
+	r *recorder
+}
+
+func (c *recorderConn) Prepare(query string) (driver.Stmt, error) {
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.r.prepares++
+	return &recorderStmt{c.r, query}, nil
+}
+func (c *recorderConn) Close() error { return nil }
+func (c *recorderConn) Begin() (driver.Tx, error) {
+	return c, c.r.record("BEGIN", nil)
+}
+func (c *recorderConn) Commit() error   { return c.r.record("COMMIT", nil) }
+func (c *recorderConn) Rollback() error { return c.r.record("ROLLBACK", nil) }
+
+type recorderStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s *recorderStmt) Close() error {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.closes++
+	return nil
+}
+func (s *recorderStmt) NumInput() int { return -1 }
+
+func (s *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.r.record(s.query, args); err != nil {
+		return nil, err
+	}
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.lastId++
+	res := &recorderResult{id: s.r.lastId, affected: 1}
+	if len(s.r.affected) > 0 {
+		res.affected = s.r.affected[0]
+		s.r.affected = s.r.affected[1:]
+	}
+	return res, nil
+}
+
+func (s *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.r.record(s.query, args); err != nil {
+		return nil, err
+	}
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	rows := &recorderRows{}
+	if len(s.r.results) > 0 {
+		res := s.r.results[0]
+		s.r.results = s.r.results[1:]
+		for _, c := range res[0] {
+			rows.cols = append(rows.cols, c.(string))
+		}
+		rows.rows = res[1:]
+	}
+	return rows, nil
+}
+
+type recorderResult struct {
+	id       int64
+	affected int64
+}
+
+func (r *recorderResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r *recorderResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type recorderRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *recorderRows) Columns() []string { return r.cols }
+func (r *recorderRows) Close() error      { return nil }
+func (r *recorderRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -1,69 +1,109 @@
 package sorm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 )
 
+// executor runs the sql of a table, it's a Database or a Tx.
+type executor interface {
+	ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error)
+	CreateQueryContext(ctx context.Context, sql string) (Query, error)
+	Dialect() Dialect
+	structMapper() *mapper
+}
+
 type table struct {
 	name string
-	db   Database
+	db   executor
 }
 
 func (t *table) Insert(values ...interface{}) (res sql.Result, err error) {
+	return t.InsertContext(context.Background(), values...)
+}
+
+func (t *table) InsertContext(ctx context.Context, values ...interface{}) (res sql.Result, err error) {
 	if t.db == nil {
 		return nil, fmt.Errorf("db is not opened")
 	}
 
+	values, opts := splitInsertOptions(values)
 	if len(values) == 0 {
 		return nil, fmt.Errorf("Table.Insert must have an input value")
 	}
+	if rows, ok := batchRows(values[0]); ok && len(values) == 1 {
+		return t.insertBatch(ctx, rows, opts)
+	}
 
-	insertSql := fmt.Sprintf("insert into %v(", t.name)
+	verb, suffix := "insert into", ""
+	if opts.ignore {
+		verb, suffix = insertIgnore(t.db.Dialect())
+	}
+	insertSql := fmt.Sprintf("%v %v(", verb, t.name)
 	valueSql := "("
 	args := make([]interface{}, 0)
 	var sql string
+	var autoincr *fieldValue // the autoincr field to write the generated id back
 
 	obj := values[0]
 	obv := reflect.ValueOf(obj)
 	if obv.Kind() == reflect.Ptr {
+		if k := obv.Type().Elem().Kind(); obv.IsNil() && (k == reflect.Struct || k == reflect.Map) {
+			return nil, fmt.Errorf("argument 1 is a nil pointer of %v", obv.Type().Elem())
+		}
 		obv = obv.Elem()
 	}
 
 	switch obv.Kind() {
 	case reflect.Struct:
-		tis := getFieldInfoFromStruct(obv)
+		tis := t.db.structMapper().getFieldInfoFromStruct(obv)
 		if len(tis) == 0 {
-			return
+			return nil, fmt.Errorf("no valid fields found in the object")
 		}
 		for _, v := range tis {
 			if v.fn == "_" {
 				continue
 			}
+			if v.autoincr && v.fp.Elem().IsZero() {
+				// let the database generate it
+				autoincr = v
+				continue
+			}
+			if v.omitted(false) {
+				continue
+			}
 
-			insertSql += v.fn + ","
+			insertSql += quoteColumn(t.db.Dialect(), v.fn) + ","
 			valueSql += fmt.Sprintf("?,")
-			args = append(args, v.fp.Interface())
+			args = append(args, v.value())
 		}
 
-		sql = insertSql[0:len(insertSql)-1] + ") values" + valueSql[0:len(valueSql)-1] + ")"
+		sql = insertSql[0:len(insertSql)-1] + ") values" + valueSql[0:len(valueSql)-1] + ")" + suffix
+		if autoincr != nil && t.db.Dialect().InsertIdStrategy() == InsertIdReturning {
+			sql += " returning " + quoteColumn(t.db.Dialect(), autoincr.fn)
+		}
 	case reflect.Map:
-		keys := obv.MapKeys()
+		keys, err := sortedMapKeys(obv)
+		if err != nil {
+			return nil, err
+		}
 		for _, v := range keys {
-			k := v.Interface().(string)
-			insertSql += k + ","
+			k := v.String()
+			insertSql += quoteColumn(t.db.Dialect(), k) + ","
 			valueSql += fmt.Sprintf("?,")
 			args = append(args, obv.MapIndex(v).Interface())
 		}
 
-		sql = insertSql[0:len(insertSql)-1] + ") values" + valueSql[0:len(valueSql)-1] + ")"
+		sql = insertSql[0:len(insertSql)-1] + ") values" + valueSql[0:len(valueSql)-1] + ")" + suffix
 	default:
-		insertSql = fmt.Sprintf("insert into %v values(", t.name)
+		insertSql = fmt.Sprintf("%v %v values(", verb, t.name)
 		insertSql += strings.Repeat("?,", len(values))
 		args = values
-		sql = insertSql[0:len(insertSql)-1] + ")"
+		sql = insertSql[0:len(insertSql)-1] + ")" + suffix
 	}
 
 	if len(args) == 0 {
@@ -72,27 +112,122 @@ func (t *table) Insert(values ...interface{}) (res sql.Result, err error) {
 	if printSql {
 		fmt.Printf("table.Insert: %v, args %v\n", sql, args)
 	}
-	return t.db.Exec(sql, args...)
+	if autoincr != nil {
+		return t.insertAndFetchId(ctx, sql, args, autoincr)
+	}
+	return t.db.ExecContext(ctx, sql, args...)
+}
+
+// insertAndFetchId runs the insert, and writes the generated id back into the
+// autoincr field.
+func (t *table) insertAndFetchId(ctx context.Context, sql string, args []interface{}, ti *fieldValue) (res sql.Result, err error) {
+	if t.db.Dialect().InsertIdStrategy() == InsertIdReturning {
+		q, err := t.db.CreateQueryContext(ctx, sql)
+		if err != nil {
+			return nil, err
+		}
+		defer q.Close()
+		rows, err := q.ExecContext(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		err = rows.Next(ti.fp.Interface())
+		if err == io.EOF {
+			// the row is ignored by on conflict do nothing
+			return &insertResult{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &insertResult{lastInsertId: autoincrId(ti.fp.Elem()), rowsAffected: 1}, nil
+	}
+
+	res, err = t.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if !setAutoincrId(ti.fp.Elem(), id) {
+		return res, fmt.Errorf("autoincr field %v must be an integer", ti.fn)
+	}
+	return res, nil
 }
 
-func (t *table) Delete(filter string) (res sql.Result, err error) {
+// setAutoincrId writes id into the autoincr field f, a nil pointer field is
+// allocated. It returns false if f is not an integer or a pointer of one.
+func setAutoincrId(f reflect.Value, id int64) bool {
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		f = f.Elem()
+	}
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f.SetUint(uint64(id))
+	default:
+		return false
+	}
+	return true
+}
+
+// autoincrId returns the id held by the autoincr field f, or pointed by it.
+func autoincrId(f reflect.Value) int64 {
+	switch f = reflect.Indirect(f); f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(f.Uint())
+	}
+	return 0
+}
+
+// insertResult is the sql.Result of an insert whose id is read by returning.
+type insertResult struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (r *insertResult) LastInsertId() (int64, error) {
+	return r.lastInsertId, nil
+}
+
+func (r *insertResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+func (t *table) Delete(filter interface{}, args ...interface{}) (res sql.Result, err error) {
+	return t.DeleteContext(context.Background(), filter, args...)
+}
+
+func (t *table) DeleteContext(ctx context.Context, filter interface{}, args ...interface{}) (res sql.Result, err error) {
 	if t.db == nil {
 		return nil, fmt.Errorf("db is not opened")
 	}
 
-	var sql string
-	if filter == "" {
-		sql = "delete from " + t.name
-	} else {
-		sql = "delete from " + t.name + " where " + filter
+	where, args, err := whereClause(t.db.Dialect(), filter, args)
+	if err != nil {
+		return nil, err
 	}
+	sql := "delete from " + t.name + where
 	if printSql {
-		fmt.Printf("table.Delete: %v\n", sql)
+		fmt.Printf("table.Delete: %v, args %v\n", sql, args)
 	}
-	return t.db.Exec(sql)
+	return t.db.ExecContext(ctx, sql, args...)
+}
+
+func (t *table) Update(filter interface{}, value interface{}, filterArgs ...interface{}) (res sql.Result, err error) {
+	return t.UpdateContext(context.Background(), filter, value, filterArgs...)
 }
 
-func (t *table) Update(filter string, value interface{}) (res sql.Result, err error) {
+func (t *table) UpdateContext(ctx context.Context, filter interface{}, value interface{}, filterArgs ...interface{}) (res sql.Result, err error) {
 	if t.db == nil {
 		return nil, fmt.Errorf("db is not opened")
 	}
@@ -108,23 +243,26 @@ func (t *table) Update(filter string, value interface{}) (res sql.Result, err er
 
 	switch obv.Kind() {
 	case reflect.Struct:
-		tis := getFieldInfoFromStruct(obv)
+		tis := t.db.structMapper().getFieldInfoFromStruct(obv)
 		if len(tis) == 0 {
 			return nil, fmt.Errorf("no receiver fields found")
 		}
 		for _, v := range tis {
-			if v.fn == "_" {
+			if v.fn == "_" || v.omitted(true) {
 				continue
 			}
 
-			whereSql += v.fn + "=?,"
-			args = append(args, v.fp.Interface())
+			whereSql += quoteColumn(t.db.Dialect(), v.fn) + "=?,"
+			args = append(args, v.value())
 		}
 	case reflect.Map:
-		keys := obv.MapKeys()
+		keys, err := sortedMapKeys(obv)
+		if err != nil {
+			return nil, err
+		}
 		for _, v := range keys {
-			k := v.Interface().(string)
-			whereSql += k + "=?,"
+			k := v.String()
+			whereSql += quoteColumn(t.db.Dialect(), k) + "=?,"
 			args = append(args, obv.MapIndex(v).Interface())
 		}
 	default:
@@ -135,33 +273,161 @@ func (t *table) Update(filter string, value interface{}) (res sql.Result, err er
 		return nil, fmt.Errorf("no valid fields found in the object")
 	}
 
-	var sql string
-	if filter == "" {
-		sql = updateSql + whereSql[0:len(whereSql)-1]
-	} else {
-		sql = updateSql + whereSql[0:len(whereSql)-1] + " where " + filter
+	where, filterArgs, err := whereClause(t.db.Dialect(), filter, filterArgs)
+	if err != nil {
+		return nil, err
 	}
+	sql := updateSql + whereSql[0:len(whereSql)-1] + where
+	// the filter placeholders follow the set ones
+	args = append(args, filterArgs...)
 	if printSql {
 		fmt.Printf("table.Update: %v, args %v\n", sql, args)
 	}
-	return t.db.Exec(sql, args...)
+	return t.db.ExecContext(ctx, sql, args...)
+}
+
+func (t *table) Query(filter interface{}, args ...interface{}) (res Result, err error) {
+	return t.QueryContext(context.Background(), filter, args...)
 }
 
-func (t *table) Query(filter string) (res Result, err error) {
+func (t *table) QueryContext(ctx context.Context, filter interface{}, args ...interface{}) (res Result, err error) {
 	if t.db == nil {
 		return nil, fmt.Errorf("db is not opened")
 	}
 
-	var sql string
-	if filter == "" {
-		sql = "select * from " + t.name
-	} else {
-		sql = "select * from " + t.name + " where " + filter
+	where, args, err := whereClause(t.db.Dialect(), filter, args)
+	if err != nil {
+		return nil, err
+	}
+	sql := "select * from " + t.name + where
+	return queryOnce(ctx, t.db, sql, args)
+}
+
+// queryOnce prepares and runs a query, the statement is closed along with the
+// result, so that it's not leaked on the server.
+func queryOnce(ctx context.Context, db executor, sql string, args []interface{}) (res Result, err error) {
+	q, err := db.CreateQueryContext(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	res, err = q.ExecContext(ctx, args...)
+	if err != nil {
+		q.Close()
+		return nil, err
+	}
+	if r, ok := res.(*result); ok {
+		r.query = q
+	}
+	return res, nil
+}
+
+func (t *table) Get(ptr interface{}, keys ...interface{}) (err error) {
+	return t.GetContext(context.Background(), ptr, keys...)
+}
+
+func (t *table) GetContext(ctx context.Context, ptr interface{}, keys ...interface{}) (err error) {
+	cond, err := t.keyCond(ptr, keys)
+	if err != nil {
+		return err
+	}
+
+	res, err := t.Select().Where(cond).Limit(1).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	err = res.Next(ptr)
+	if err == io.EOF {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+func (t *table) Save(ptr interface{}) (res sql.Result, err error) {
+	return t.SaveContext(context.Background(), ptr)
+}
+
+func (t *table) SaveContext(ctx context.Context, ptr interface{}) (res sql.Result, err error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("Table.Save needs a pointer of struct")
+	}
+	pks := t.db.structMapper().getPrimaryKeyFromStruct(v.Elem())
+	if len(pks) == 0 {
+		return nil, fmt.Errorf("no primary key field tagged by pk in %v", v.Elem().Type())
 	}
-	q, err := t.db.CreateQuery(sql)
+
+	for _, pk := range pks {
+		if pk.autoincr && pk.fp.Elem().IsZero() {
+			// the key is not generated yet
+			return t.InsertContext(ctx, ptr)
+		}
+	}
+
+	cond, err := t.keyCond(ptr, nil)
 	if err != nil {
 		return nil, err
 	}
+	res, err = t.UpdateContext(ctx, cond, ptr)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return res, nil
+	}
 
-	return q.Exec()
+	// mysql reports 0 rows affected if nothing is changed, so check the row
+	exists, err := t.Select("1").Where(cond).Limit(1).ExecContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var one int
+	err = exists.Next(&one)
+	exists.Close()
+	if err == nil {
+		return res, nil
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+	return t.InsertContext(ctx, ptr)
+}
+
+func (t *table) DeleteByKey(ptr interface{}) (res sql.Result, err error) {
+	return t.DeleteByKeyContext(context.Background(), ptr)
+}
+
+func (t *table) DeleteByKeyContext(ctx context.Context, ptr interface{}) (res sql.Result, err error) {
+	cond, err := t.keyCond(ptr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.DeleteContext(ctx, cond)
+}
+
+// keyCond renders the primary key condition of the struct, the key values are
+// taken from the struct if keys is empty.
+func (t *table) keyCond(ptr interface{}, keys []interface{}) (cond Cond, err error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("argument 1 is not a pointer of struct")
+	}
+	pks := t.db.structMapper().getPrimaryKeyFromStruct(v.Elem())
+	if len(pks) == 0 {
+		return nil, fmt.Errorf("no primary key field tagged by pk in %v", v.Elem().Type())
+	}
+	if len(keys) > 0 && len(keys) != len(pks) {
+		return nil, fmt.Errorf("%v has %v primary key fields, but got %v keys", v.Elem().Type(), len(pks), len(keys))
+	}
+
+	conds := make([]Cond, len(pks))
+	for i, pk := range pks {
+		if len(keys) > 0 {
+			conds[i] = Eq(pk.fn, keys[i])
+		} else {
+			conds[i] = Eq(pk.fn, pk.fp.Elem().Interface())
+		}
+	}
+	return And(conds...), nil
 }
@@ -1,9 +1,14 @@
 package sorm
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type helper func(res Result, t *testing.T)
@@ -307,3 +312,802 @@ func TestTable(t *testing.T) {
 	testTableUpdate(tb, t)
 	testTableDelete(tb, t)
 }
+
+func TestTableFilterArgs(t *testing.T) {
+	db, rec := newRecorderDB("postgres", t)
+	defer db.Close()
+
+	tb, err := db.BindTable("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tb.Delete("id=? and name=?", 1, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args := rec.last()
+	if sql != "delete from xx where id=$1 and name=$2" || !reflect.DeepEqual(args, []driver.Value{int64(1), "x"}) {
+		t.Errorf("Delete got %q %v", sql, args)
+	}
+
+	_, err = tb.Update("id=?", map[string]interface{}{"dummy": "d"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args = rec.last()
+	if sql != "update xx set \"dummy\"=$1 where id=$2" || !reflect.DeepEqual(args, []driver.Value{"d", int64(2)}) {
+		t.Errorf("Update got %q %v", sql, args)
+	}
+
+	_, err = tb.Update("id=? and name<>?", &tbs{SId: 1001, Dummy: "d"}, 1001, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args = rec.last()
+	if !strings.HasSuffix(sql, " where id=$3 and name<>$4") || !reflect.DeepEqual(args[2:], []driver.Value{int64(1001), ""}) {
+		t.Errorf("Update got %q %v", sql, args)
+	}
+
+	res, err := tb.Query("id>? and id<?", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Close()
+	sql, args = rec.last()
+	if sql != "select * from xx where id>$1 and id<$2" || !reflect.DeepEqual(args, []driver.Value{int64(0), int64(10)}) {
+		t.Errorf("Query got %q %v", sql, args)
+	}
+}
+
+type keyed struct {
+	Id    int    `sorm:"fn=id;pk;autoincr"`
+	Name  string `sorm:"fn=name"`
+	Dummy string
+}
+
+type composite struct {
+	A     int    `sorm:"pk"`
+	B     string `sorm:"pk"`
+	Value int
+}
+
+func TestTableKeys(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, err := db.BindTable("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Get by keys
+	rec.addRows([]driver.Value{"id", "name", "dummy"}, []driver.Value{int64(3), "name3", "dummy3"})
+	k := &keyed{}
+	err = tb.Get(k, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *k != (keyed{3, "name3", "dummy3"}) {
+		t.Errorf("Get got %+v", k)
+	}
+	query, args := rec.last()
+	if query != "select * from xx where `id` = ? limit 1" || !reflect.DeepEqual(args, []driver.Value{int64(3)}) {
+		t.Errorf("Get got %q %v", query, args)
+	}
+
+	// Get by the keys of the struct, not found
+	c := &composite{A: 1, B: "b"}
+	err = tb.Get(c)
+	if err != sql.ErrNoRows {
+		t.Errorf("Get err=%v, expect sql.ErrNoRows", err)
+	}
+	query, args = rec.last()
+	if query != "select * from xx where (`a` = ? and `b` = ?) limit 1" || !reflect.DeepEqual(args, []driver.Value{int64(1), "b"}) {
+		t.Errorf("Get got %q %v", query, args)
+	}
+	if err = tb.Get(c, 1); err == nil {
+		t.Errorf("Get with wrong key count should fail")
+	}
+	if err = tb.Get(&tbs{}, 1); err == nil {
+		t.Errorf("Get without pk field should fail")
+	}
+
+	// Save inserts if the autoincr key is zero
+	rec.reset()
+	_, err = tb.Save(&keyed{Name: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.sqls) != 1 || !strings.HasPrefix(rec.sqls[0], "insert into xx(") {
+		t.Errorf("Save got %q", rec.sqls)
+	}
+
+	// Save updates an existing row
+	rec.reset()
+	_, err = tb.Save(&keyed{Id: 5, Name: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.sqls) != 1 || !strings.HasPrefix(rec.sqls[0], "update xx set ") || !strings.HasSuffix(rec.sqls[0], " where `id` = ?") {
+		t.Errorf("Save got %q", rec.sqls)
+	}
+
+	// Save inserts if the row does not exist
+	rec.reset()
+	rec.affected = []int64{0}
+	_, err = tb.Save(&composite{A: 1, B: "b", Value: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.sqls) != 3 || rec.sqls[1] != "select 1 from xx where (`a` = ? and `b` = ?) limit 1" || !strings.HasPrefix(rec.sqls[2], "insert into xx(") {
+		t.Errorf("Save got %q", rec.sqls)
+	}
+
+	// DeleteByKey
+	_, err = tb.DeleteByKey(&keyed{Id: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args = rec.last()
+	if query != "delete from xx where `id` = ?" || !reflect.DeepEqual(args, []driver.Value{int64(5)}) {
+		t.Errorf("DeleteByKey got %q %v", query, args)
+	}
+}
+
+func TestTableInsertAutoIncr(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	tb, _ := db.BindTable("xx")
+
+	rec.lastId = 41
+	k := &keyed{Name: "n", Dummy: "d"}
+	res, err := tb.Insert(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args := rec.last()
+	if strings.Contains(query, "id") || len(args) != 2 {
+		t.Errorf("the zero autoincr field should not be inserted, got %q %v", query, args)
+	}
+	if id, _ := res.LastInsertId(); k.Id != 42 || id != 42 {
+		t.Errorf("Insert got id %v, LastInsertId %v, expect 42", k.Id, id)
+	}
+
+	// a non-zero autoincr field is inserted as it is
+	k = &keyed{Id: 7, Name: "n"}
+	_, err = tb.Insert(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, args = rec.last(); len(args) != 3 || k.Id != 7 {
+		t.Errorf("Insert got args %v, id %v", args, k.Id)
+	}
+
+	// a nil pointer autoincr field is allocated
+	kp := &keyedPtr{Name: "n"}
+	res, err = tb.Insert(kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := res.LastInsertId(); kp.Id == nil || *kp.Id != id || id == 0 {
+		t.Errorf("Insert got id %v, LastInsertId %v", kp.Id, id)
+	}
+	db.Close()
+
+	db, rec = newRecorderDB("postgres", t)
+	defer db.Close()
+	tb, _ = db.BindTable("xx")
+
+	rec.addRows([]driver.Value{"id"}, []driver.Value{int64(9)})
+	k = &keyed{Name: "n", Dummy: "d"}
+	res, err = tb.Insert(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, _ = rec.last()
+	if !strings.HasSuffix(query, ` returning "id"`) {
+		t.Errorf("Insert got %q", query)
+	}
+	id, _ := res.LastInsertId()
+	ra, _ := res.RowsAffected()
+	if k.Id != 9 || id != 9 || ra != 1 {
+		t.Errorf("Insert got id %v, LastInsertId %v, RowsAffected %v", k.Id, id, ra)
+	}
+
+	rec.addRows([]driver.Value{"id"}, []driver.Value{int64(10)})
+	kp = &keyedPtr{Name: "n"}
+	res, err = tb.Insert(kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ = res.LastInsertId(); kp.Id == nil || *kp.Id != 10 || id != 10 {
+		t.Errorf("Insert got id %v, LastInsertId %v", kp.Id, id)
+	}
+}
+
+type keyedPtr struct {
+	Id   *int64 `sorm:"pk;autoincr"`
+	Name string
+}
+
+func TestTableColumnOrder(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("xx")
+
+	row := map[string]interface{}{"name": "n", "id": 1, "dummy": "d", "age": 3}
+	ts := &tbs{SId: 1, Dummy: "d"}
+	for i := 0; i < 10; i++ {
+		_, err := tb.Insert(&row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query, args := rec.last(); query != "insert into xx(`age`,`dummy`,`id`,`name`) values(?,?,?,?)" || !reflect.DeepEqual(args, []driver.Value{int64(3), "d", int64(1), "n"}) {
+			t.Fatalf("got %q %v", query, args)
+		}
+
+		_, err = tb.Update("id=?", row, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query, _ := rec.last(); query != "update xx set `age`=?,`dummy`=?,`id`=?,`name`=? where id=?" {
+			t.Fatalf("got %q", query)
+		}
+
+		_, err = tb.Insert(ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query, _ := rec.last(); query != "insert into xx(`id`,`dummy`) values(?,?)" {
+			t.Fatalf("got %q", query)
+		}
+
+		_, err = tb.Update("", ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query, _ := rec.last(); query != "update xx set `id`=?,`dummy`=?" {
+			t.Fatalf("got %q", query)
+		}
+
+		_, err = tb.Insert([]map[string]interface{}{row, row})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query, _ := rec.last(); query != "insert into xx(`age`,`dummy`,`id`,`name`) values(?,?,?,?),(?,?,?,?)" {
+			t.Fatalf("got %q", query)
+		}
+	}
+}
+
+func TestStructMeta(t *testing.T) {
+	meta := defaultMapper.structMeta(reflect.TypeOf(keyed{}))
+	if meta != defaultMapper.structMeta(reflect.TypeOf(keyed{})) {
+		t.Fatal("the meta of a type should be cached")
+	}
+	if len(meta.fields) != 3 || len(meta.pks) != 1 || meta.pks[0].fn != "id" {
+		t.Fatalf("wrong meta %+v", meta)
+	}
+
+	meta = defaultMapper.structMeta(reflect.TypeOf(userOrder{}))
+	if len(meta.fields) != 1 || meta.fields[0].fn != "total" {
+		t.Fatalf("nested structs should not be written, got %+v", meta.fields)
+	}
+	for col, index := range map[string][]int{"u.id": {0, 0}, "o.amount": {1, 1}, "total": {2}} {
+		if !reflect.DeepEqual(meta.columns[col], index) {
+			t.Fatalf("column %v got index %v, want %v", col, meta.columns[col], index)
+		}
+	}
+
+	// the cache is shared by the goroutines
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			var u userOrder
+			args := defaultMapper.getScanFieldFromStruct(reflect.ValueOf(&u).Elem(), []string{"u.id", "o.id", "total", "unknown"})
+			*args[0].(*int) = i
+			*args[2].(*int) = i * 2
+			if _, ok := args[3].(*sql.RawBytes); !ok || u.User.Id != i || u.Total != i*2 || args[1] != &u.Order.Id {
+				done <- fmt.Errorf("wrong receivers %v for %+v", args, u)
+				return
+			}
+			done <- nil
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type baseModel struct {
+	Id      int `sorm:"pk;autoincr"`
+	Created time.Time
+}
+
+type address struct {
+	City   string
+	Street string
+}
+
+type member struct {
+	baseModel
+	Name string
+	Home address `sorm:"prefix=home_"`
+	Note sql.NullString
+}
+
+func TestTableEmbedded(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("member")
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := &member{baseModel: baseModel{Created: now}, Name: "n", Home: address{"c", "s"}}
+	rec.lastId = 5
+	_, err := tb.Insert(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args := rec.last()
+	if query != "insert into member(`created`,`name`,`home_city`,`home_street`,`note`) values(?,?,?,?,?)" || len(args) != 5 {
+		t.Fatalf("Insert got %q %v", query, args)
+	}
+	if m.Id != 6 {
+		t.Fatalf("Insert should write back the embedded id, got %v", m.Id)
+	}
+
+	_, err = tb.Save(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ = rec.last(); query != "update member set `id`=?,`created`=?,`name`=?,`home_city`=?,`home_street`=?,`note`=? where `id` = ?" {
+		t.Fatalf("Save got %q", query)
+	}
+
+	rec.addRows([]driver.Value{"id", "created", "name", "home_city", "home_street", "note"},
+		[]driver.Value{int64(7), now, "x", "city", "street", "memo"})
+	var got member
+	err = tb.Get(&got, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := member{baseModel{7, now}, "x", address{"city", "street"}, sql.NullString{String: "memo", Valid: true}}
+	if got != expect {
+		t.Fatalf("Get got %+v, want %+v", got, expect)
+	}
+}
+
+type nullable struct {
+	Id      int64
+	Name    *string
+	Age     *int64
+	Born    *time.Time
+	Score   sql.NullInt64
+	Comment string `sorm:"nullzero"`
+}
+
+func TestTableNull(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("xx")
+
+	name := "n"
+	_, err := tb.Insert(&nullable{Id: 1, Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args := rec.last()
+	if query != "insert into xx(`id`,`name`,`age`,`born`,`score`,`comment`) values(?,?,?,?,?,?)" ||
+		!reflect.DeepEqual(args, []driver.Value{int64(1), "n", nil, nil, nil, nil}) {
+		t.Fatalf("Insert got %q %#v", query, args)
+	}
+
+	_, err = tb.Update("id=?", &nullable{Id: 1, Score: sql.NullInt64{Int64: 3, Valid: true}, Comment: "c"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, args = rec.last(); !reflect.DeepEqual(args, []driver.Value{int64(1), nil, nil, nil, int64(3), "c", int64(1)}) {
+		t.Fatalf("Update got %#v", args)
+	}
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	cols := []driver.Value{"id", "name", "age", "born", "score", "comment"}
+	rec.addRows(cols,
+		[]driver.Value{int64(1), "a", int64(2), now, int64(3), "c"},
+		[]driver.Value{int64(2), nil, nil, nil, nil, nil})
+	q, _ := db.CreateQuery("select * from xx")
+	res, _ := q.Exec()
+	var rows []nullable
+	err = res.All(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("All got %v rows", len(rows))
+	}
+	r := rows[0]
+	if *r.Name != "a" || *r.Age != 2 || !r.Born.Equal(now) || r.Score.Int64 != 3 || r.Comment != "c" {
+		t.Fatalf("All got %+v", r)
+	}
+	if r = rows[1]; r != (nullable{Id: 2}) {
+		t.Fatalf("All got %+v for NULL", r)
+	}
+
+	rec.addRows(cols, []driver.Value{int64(3), nil, nil, nil, nil, nil})
+	res, _ = q.Exec()
+	n := nullable{Name: &name, Comment: "x"}
+	err = res.Next(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != (nullable{Id: 3}) {
+		t.Fatalf("Next got %+v for NULL", n)
+	}
+
+	// a qualified column falls back to the plain field, so does nullzero
+	rec.addRows([]driver.Value{"x.id", "x.comment"}, []driver.Value{int64(4), nil})
+	res, _ = q.Exec()
+	n = nullable{Comment: "x"}
+	err = res.Next(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != (nullable{Id: 4}) {
+		t.Fatalf("Next got %+v for a qualified NULL", n)
+	}
+}
+
+func TestTableByValue(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("xx")
+
+	name := "n"
+	_, err := tb.Insert(nullable{Id: 1, Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args := rec.last()
+	if query != "insert into xx(`id`,`name`,`age`,`born`,`score`,`comment`) values(?,?,?,?,?,?)" ||
+		!reflect.DeepEqual(args, []driver.Value{int64(1), "n", nil, nil, nil, nil}) {
+		t.Fatalf("Insert got %q %#v", query, args)
+	}
+
+	_, err = tb.Update("id=?", nullable{Id: 1, Score: sql.NullInt64{Int64: 3, Valid: true}, Comment: "c"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, args = rec.last(); !reflect.DeepEqual(args, []driver.Value{int64(1), nil, nil, nil, int64(3), "c", int64(1)}) {
+		t.Fatalf("Update got %#v", args)
+	}
+
+	// the generated id can't be written back into a value
+	_, err = tb.Insert(keyed{Name: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ = rec.last(); query != "insert into xx(`name`,`dummy`) values(?,?)" {
+		t.Fatalf("Insert got %q", query)
+	}
+}
+
+type unexported struct {
+	baseModel
+	Name    string
+	secret  string
+	counter int
+}
+
+type stamp struct{ sql.NullString }
+
+type unexportedScanner struct {
+	stamp
+	Name string
+}
+
+func TestTableUnexported(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("xx")
+
+	// passed by value, the generated id can't be written back
+	_, err := tb.Insert(unexported{Name: "n", secret: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, args := rec.last(); query != "insert into xx(`created`,`name`) values(?,?)" || len(args) != 2 {
+		t.Fatalf("Insert got %q %v", query, args)
+	}
+
+	_, err = tb.Update("", unexported{Name: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "update xx set `id`=?,`created`=?,`name`=?" {
+		t.Fatalf("Update got %q", query)
+	}
+
+	rec.addRows([]driver.Value{"id", "name", "secret"}, []driver.Value{int64(1), "x", "y"})
+	q, _ := db.CreateQuery("select * from xx")
+	res, _ := q.Exec()
+	var u unexported
+	err = res.Next(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Id != 1 || u.Name != "x" || u.secret != "" {
+		t.Fatalf("Next got %+v", u)
+	}
+
+	var nilPtr *unexported
+	if _, err = tb.Insert(nilPtr); err == nil {
+		t.Fatal("Insert should fail on a nil pointer")
+	}
+	if _, err = tb.Insert(map[int]interface{}{1: "x"}); err == nil {
+		t.Fatal("Insert should fail on a map of non-string keys")
+	}
+	if _, err = tb.Insert(struct{ a int }{1}); err == nil {
+		t.Fatal("Insert should fail on a struct of no exported fields")
+	}
+
+	// an unexported embedded column can't be read, it's skipped
+	_, err = tb.Insert(&unexportedScanner{stamp: stamp{sql.NullString{String: "s", Valid: true}}, Name: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into xx(`name`) values(?)" {
+		t.Fatalf("Insert got %q", query)
+	}
+
+	rec.addRows([]driver.Value{"id"}, []driver.Value{int64(1)})
+	res, _ = q.Exec()
+	if err = res.Next(nilPtr); err == nil {
+		t.Fatal("Next should fail on a nil pointer")
+	}
+	res.Close()
+	rec.addRows([]driver.Value{"id"}, []driver.Value{int64(1)})
+	res, _ = q.Exec()
+	if err = res.Next(&map[int]interface{}{}); err == nil {
+		t.Fatal("Next should fail on a map of non-string keys")
+	}
+	res.Close()
+}
+
+type tagged struct {
+	Id      int    `sorm:"pk;autoincr"`
+	Name    string `sorm:"omitempty"`
+	Total   int    `sorm:"readonly"`
+	Created string `sorm:"insertonly"`
+	Note    string
+}
+
+func TestTableWriteTags(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("xx")
+
+	_, err := tb.Insert(&tagged{Total: 3, Created: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, args := rec.last(); query != "insert into xx(`created`,`note`) values(?,?)" || !reflect.DeepEqual(args, []driver.Value{"c", ""}) {
+		t.Fatalf("Insert got %q %v", query, args)
+	}
+	_, err = tb.Insert(&tagged{Name: "n", Total: 3, Created: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into xx(`name`,`created`,`note`) values(?,?,?)" {
+		t.Fatalf("Insert got %q", query)
+	}
+
+	_, err = tb.Update("id=?", &tagged{Id: 1, Total: 3, Created: "c", Note: "x"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, args := rec.last(); query != "update xx set `id`=?,`note`=? where id=?" || !reflect.DeepEqual(args, []driver.Value{int64(1), "x", int64(1)}) {
+		t.Fatalf("Update got %q %v", query, args)
+	}
+
+	_, err = tb.Save(&tagged{Id: 1, Name: "n", Created: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "update xx set `id`=?,`name`=?,`note`=? where `id` = ?" {
+		t.Fatalf("Save got %q", query)
+	}
+
+	// the rows of a zero omitempty field are inserted apart from the others
+	_, err = tb.Insert([]tagged{{Created: "a"}, {Created: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into xx(`created`,`note`) values(?,?),(?,?)" {
+		t.Fatalf("Insert got %q", query)
+	}
+	rec.reset()
+	_, err = tb.Insert([]tagged{{Created: "a"}, {Name: "n", Created: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"insert into xx(`created`,`note`) values(?,?)", "insert into xx(`name`,`created`,`note`) values(?,?,?)"}; !reflect.DeepEqual(rec.sqls, expect) {
+		t.Fatalf("Insert got %q", rec.sqls)
+	}
+
+	// an upsert doesn't update the insertonly columns by default
+	for dbtype, expect := range map[string]string{
+		"mysql":    "insert into xx(`id`,`created`,`note`) values(?,?,?) on duplicate key update `note`=values(`note`)",
+		"postgres": `insert into xx("id","created","note") values($1,$2,$3) on conflict ("id") do update set "note"=excluded."note"`,
+	} {
+		udb, urec := newRecorderDB(dbtype, t)
+		utb, _ := udb.BindTable("xx")
+		_, err = utb.Upsert(&tagged{Id: 1, Total: 3, Created: "c"}, []string{"id"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query, _ := urec.last(); query != expect {
+			t.Errorf("%v Upsert got %q", dbtype, query)
+		}
+		udb.Close()
+	}
+
+	// the readonly columns are still read
+	rec.addRows([]driver.Value{"id", "name", "total", "created", "note"}, []driver.Value{int64(1), "n", int64(9), "c", "x"})
+	var got tagged
+	err = tb.Get(&got, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (tagged{1, "n", 9, "c", "x"}) {
+		t.Fatalf("Get got %+v", got)
+	}
+}
+
+func TestTableStmtClose(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("xx")
+
+	cols := []driver.Value{"id", "name", "dummy"}
+	for i := 0; i < 3; i++ {
+		rec.addRows(cols, []driver.Value{int64(1), "n", "d"})
+		res, err := tb.Select().Where(Eq("id", 1)).Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []keyed
+		if err = res.All(&rows); err != nil {
+			t.Fatal(err)
+		}
+
+		rec.addRows(cols, []driver.Value{int64(1), "n", "d"})
+		res, err = tb.Query("id=?", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var k keyed
+		for res.Next(&k) == nil {
+		}
+
+		rec.addRows(cols)
+		res, _ = tb.Select().Exec()
+		res.Close()
+
+		rec.addRows(cols, []driver.Value{int64(1), "n", "d"})
+		if err = tb.Get(&k, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		// update affects no row, then checks the row exists
+		rec.affected = []int64{0}
+		rec.addRows([]driver.Value{"1"}, []driver.Value{int64(1)})
+		if _, err = tb.Save(&keyed{Id: 1, Name: "n"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.prepares == 0 || rec.prepares != rec.closes {
+		t.Fatalf("%v statements prepared, but %v closed", rec.prepares, rec.closes)
+	}
+}
+
+type BaseP struct {
+	Id      int `sorm:"pk;autoincr"`
+	Created time.Time
+}
+
+type memberP struct {
+	*BaseP
+	Name string
+	Home *address `sorm:"prefix=home_"`
+}
+
+type nodeP struct {
+	*nodeP
+	*NodeP
+	Name string
+}
+
+type NodeP struct {
+	*NodeP
+	Value int
+}
+
+func TestTableEmbeddedPointer(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	tb, _ := db.BindTable("member")
+
+	// the fields under a nil pointer are left to the database
+	_, err := tb.Insert(&memberP{Name: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, args := rec.last(); query != "insert into member(`name`) values(?)" || len(args) != 1 {
+		t.Fatalf("Insert got %q %v", query, args)
+	}
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := &memberP{BaseP: &BaseP{Created: now}, Name: "n", Home: &address{"c", "s"}}
+	_, err = tb.Insert(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into member(`created`,`name`,`home_city`,`home_street`) values(?,?,?,?)" || m.Id == 0 {
+		t.Fatalf("Insert got %q, id %v", query, m.Id)
+	}
+
+	_, err = tb.Update("", &memberP{Name: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "update member set `name`=?" {
+		t.Fatalf("Update got %q", query)
+	}
+
+	// the key under a nil pointer is zero, and it's inserted by Save
+	_, err = tb.Save(&memberP{Name: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query, _ := rec.last(); query != "insert into member(`name`) values(?)" {
+		t.Fatalf("Save got %q", query)
+	}
+
+	// the pointers are allocated on scan
+	rec.addRows([]driver.Value{"id", "created", "name", "home_city", "home_street"},
+		[]driver.Value{int64(7), now, "x", "city", "street"})
+	var got memberP
+	err = tb.Get(&got, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BaseP == nil || *got.BaseP != (BaseP{7, now}) || got.Name != "x" || got.Home == nil || *got.Home != (address{"city", "street"}) {
+		t.Fatalf("Get got %+v", got)
+	}
+
+	// every row of All has its own pointers
+	rec.addRows([]driver.Value{"id", "name", "home_city"},
+		[]driver.Value{int64(1), "a", "c1"}, []driver.Value{int64(2), "b", "c2"})
+	res, err := tb.Query("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []memberP
+	if err = res.All(&all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].BaseP == all[1].BaseP || all[0].Id != 1 || all[1].Id != 2 ||
+		all[0].Home == all[1].Home || all[0].Home.City != "c1" || all[1].Home.City != "c2" {
+		t.Fatalf("All got %+v %+v", all[0], all[1])
+	}
+
+	// a recursive struct is parsed once
+	meta := defaultMapper.structMeta(reflect.TypeOf(nodeP{}))
+	if len(meta.fields) != 2 || meta.fields[0].fn != "value" || meta.fields[1].fn != "name" {
+		t.Fatalf("got fields %+v", meta.fields)
+	}
+}
@@ -0,0 +1,183 @@
+package sorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type tx struct {
+	dialect   Dialect
+	tx        *sql.Tx // underlying sql transaction
+	savepoint string  // the savepoint of a nested transaction, empty for the outermost one
+	depth     int     // nesting level, 0 for the outermost transaction
+	mapper    *mapper // the struct mapper of the database
+}
+
+func (t *tx) Exec(sql string, args ...interface{}) (res sql.Result, err error) {
+	return t.ExecContext(context.Background(), sql, args...)
+}
+
+func (t *tx) ExecContext(ctx context.Context, sql string, args ...interface{}) (res sql.Result, err error) {
+	if t.tx == nil {
+		return nil, fmt.Errorf("tx is not initialized")
+	}
+	res, err = t.tx.ExecContext(ctx, Rebind(t.dialect.BindType(), sql), args...)
+	return res, ctxErr(ctx, err)
+}
+
+func (t *tx) BindTable(tn string) (tbl Table, err error) {
+	return &table{db: t, name: tn}, nil
+}
+
+func (t *tx) BindStruct(obj interface{}) (tbl Table, err error) {
+	tn, err := tableName(t.dialect, t.structMapper(), obj)
+	if err != nil {
+		return nil, err
+	}
+	return t.BindTable(tn)
+}
+
+func (t *tx) structMapper() *mapper {
+	if t.mapper == nil {
+		return defaultMapper
+	}
+	return t.mapper
+}
+
+func (t *tx) CreateQuery(sql string) (q Query, err error) {
+	return t.CreateQueryContext(context.Background(), sql)
+}
+
+func (t *tx) CreateQueryContext(ctx context.Context, sql string) (q Query, err error) {
+	if t.tx == nil {
+		return nil, fmt.Errorf("tx is not initialized")
+	}
+
+	qr := &query{sql: Rebind(t.dialect.BindType(), sql), mapper: t.structMapper()}
+	qr.stmt, err = t.tx.PrepareContext(ctx, qr.sql)
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	return qr, err
+}
+
+func (t *tx) Commit() (err error) {
+	if t.tx == nil {
+		return fmt.Errorf("tx is not initialized")
+	}
+	if t.savepoint != "" {
+		_, err = t.tx.Exec(savepointDialect(t.dialect).ReleaseSavepoint(t.savepoint))
+		return err
+	}
+	return t.tx.Commit()
+}
+
+func (t *tx) Rollback() (err error) {
+	if t.tx == nil {
+		return fmt.Errorf("tx is not initialized")
+	}
+	if t.savepoint != "" {
+		_, err = t.tx.Exec(savepointDialect(t.dialect).RollbackToSavepoint(t.savepoint))
+		return err
+	}
+	return t.tx.Rollback()
+}
+
+// RunInTx runs fn in a savepoint of the transaction, an error or panic of fn
+// only rolls back to the savepoint. opts is ignored, the savepoint always
+// shares the isolation of the transaction and is never retried.
+func (t *tx) RunInTx(ctx context.Context, opts *TxOptions, fn func(tx Tx) error) (err error) {
+	if t.tx == nil {
+		return fmt.Errorf("tx is not initialized")
+	}
+
+	nested := &tx{dialect: t.dialect, tx: t.tx, depth: t.depth + 1, mapper: t.mapper}
+	nested.savepoint = fmt.Sprintf("sorm_sp_%v", nested.depth)
+	_, err = t.tx.ExecContext(ctx, savepointDialect(t.dialect).Savepoint(nested.savepoint))
+	if err != nil {
+		return ctxErr(ctx, err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			nested.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(nested)
+	if err != nil {
+		nested.Rollback()
+		return err
+	}
+	return nested.Commit()
+}
+
+func (t *tx) Dialect() Dialect {
+	return t.dialect
+}
+
+// TxOptions configures the transaction started by RunInTx.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+
+	// how many times the function is retried when the transaction fails by a
+	// deadlock or serialization failure, 0 means no retry
+	MaxRetries int
+	// the wait before the nth retry, starting from 1, nil means no wait
+	Backoff func(retry int) time.Duration
+}
+
+func (db *database) RunInTx(ctx context.Context, opts *TxOptions, fn func(tx Tx) error) (err error) {
+	if db.db == nil {
+		return fmt.Errorf("db is not opened")
+	}
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+
+	for retry := 1; ; retry++ {
+		err = db.runInTx(ctx, opts, fn)
+		if err == nil || retry > opts.MaxRetries || !isRetryable(db.dialect, err) {
+			return err
+		}
+		if printSql {
+			fmt.Printf("Database.RunInTx: retry %v, err %v\n", retry, err)
+		}
+
+		if opts.Backoff != nil {
+			timer := time.NewTimer(opts.Backoff(retry))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+func (db *database) runInTx(ctx context.Context, opts *TxOptions, fn func(tx Tx) error) (err error) {
+	stx, err := db.db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return ctxErr(ctx, err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			stx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(&tx{dialect: db.dialect, tx: stx, mapper: db.structMapper()})
+	if err != nil {
+		// the error of fn is more useful than the one of rollback
+		stx.Rollback()
+		return err
+	}
+	return ctxErr(ctx, stx.Commit())
+}
@@ -0,0 +1,263 @@
+package sorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTxCommitRollback(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb, err := tx.BindTable("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tb.Insert(1, "name1", "dummy1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec("delete from xx where id=?", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec("delete from xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"BEGIN",
+		"insert into xx values(?,?,?)",
+		"delete from xx where id=?",
+		"COMMIT",
+		"BEGIN",
+		"delete from xx",
+		"ROLLBACK",
+	}
+	if !reflect.DeepEqual(rec.sqls, expect) {
+		t.Errorf("got sqls %q, expect %q", rec.sqls, expect)
+	}
+}
+
+func TestTx(t *testing.T) {
+	db := NewDatabase("mysql", CONN_STRING)
+	if db == nil {
+		t.Fatal("TestTx: create db failed")
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb, err := tx.BindTable("xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tb.Insert(&tbs{SId: 2000, Dummy: "tx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := db.CreateQuery("select count(*) from xx where id=?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	res, err := q.Exec(2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	var count int
+	err = res.Next(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("TestTx: got %v records after rollback, expect 0", count)
+	}
+}
+
+type stateError string
+
+func (e stateError) Error() string    { return "state " + string(e) }
+func (e stateError) SQLState() string { return string(e) }
+
+type numberError struct {
+	Number uint16
+}
+
+func (e *numberError) Error() string { return fmt.Sprintf("Error %v", e.Number) }
+
+func TestRunInTx(t *testing.T) {
+	db, rec := newRecorderDB("postgres", t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// commit
+	err := db.RunInTx(ctx, nil, func(tx Tx) error {
+		_, err := tx.Exec("delete from xx where id=?", 1)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"BEGIN", "delete from xx where id=$1", "COMMIT"}
+	if !reflect.DeepEqual(rec.sqls, expect) {
+		t.Errorf("got sqls %q, expect %q", rec.sqls, expect)
+	}
+
+	// rollback on error
+	rec.reset()
+	fnErr := errors.New("fn failed")
+	err = db.RunInTx(ctx, nil, func(tx Tx) error {
+		return fnErr
+	})
+	if err != fnErr {
+		t.Errorf("RunInTx err=%v, expect %v", err, fnErr)
+	}
+	expect = []string{"BEGIN", "ROLLBACK"}
+	if !reflect.DeepEqual(rec.sqls, expect) {
+		t.Errorf("got sqls %q, expect %q", rec.sqls, expect)
+	}
+
+	// rollback on panic
+	rec.reset()
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recover()=%v, expect \"boom\"", p)
+			}
+		}()
+		db.RunInTx(ctx, nil, func(tx Tx) error {
+			panic("boom")
+		})
+	}()
+	if !reflect.DeepEqual(rec.sqls, expect) {
+		t.Errorf("got sqls %q, expect %q", rec.sqls, expect)
+	}
+
+	// retry on serialization failure
+	rec.reset()
+	calls := 0
+	opts := &TxOptions{MaxRetries: 2, Backoff: func(retry int) time.Duration { return time.Millisecond }}
+	err = db.RunInTx(ctx, opts, func(tx Tx) error {
+		calls++
+		if calls < 3 {
+			return stateError("40001")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("RunInTx err=%v, calls=%v, expect nil and 3", err, calls)
+	}
+
+	// no more retry than MaxRetries, and no retry on other errors
+	for _, e := range []error{stateError("40001"), stateError("23505")} {
+		calls = 0
+		err = db.RunInTx(ctx, &TxOptions{MaxRetries: 1}, func(tx Tx) error {
+			calls++
+			return e
+		})
+		expectCalls := 2
+		if e == stateError("23505") {
+			expectCalls = 1
+		}
+		if err != e || calls != expectCalls {
+			t.Errorf("RunInTx err=%v, calls=%v, expect %v and %v", err, calls, e, expectCalls)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	mysql := GetDialect("mysql").(RetryDialect)
+	postgres := GetDialect("postgres").(RetryDialect)
+
+	if !mysql.IsRetryable(&numberError{1213}) || !mysql.IsRetryable(fmt.Errorf("wrapped: %w", &numberError{1205})) {
+		t.Errorf("mysql deadlock and lock wait timeout should be retryable")
+	}
+	if mysql.IsRetryable(&numberError{1062}) || mysql.IsRetryable(errors.New("Error 1213")) {
+		t.Errorf("mysql duplicate entry should not be retryable")
+	}
+	if !postgres.IsRetryable(stateError("40001")) || !postgres.IsRetryable(stateError("40P01")) {
+		t.Errorf("postgres serialization failure and deadlock should be retryable")
+	}
+	if postgres.IsRetryable(stateError("23505")) || postgres.IsRetryable(nil) {
+		t.Errorf("postgres unique violation should not be retryable")
+	}
+}
+
+func TestNestedRunInTx(t *testing.T) {
+	db, rec := newRecorderDB("mysql", t)
+	defer db.Close()
+	ctx := context.Background()
+
+	fnErr := errors.New("inner failed")
+	err := db.RunInTx(ctx, nil, func(tx Tx) error {
+		err := tx.RunInTx(ctx, nil, func(tx Tx) error {
+			_, err := tx.Exec("delete from xx where id=?", 1)
+			if err != nil {
+				return err
+			}
+			// the error only rolls back the innermost savepoint
+			if tx.RunInTx(ctx, nil, func(tx Tx) error { return fnErr }) != fnErr {
+				t.Errorf("nested RunInTx should return the error of fn")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		func() {
+			defer func() { recover() }()
+			tx.RunInTx(ctx, nil, func(tx Tx) error { panic("boom") })
+		}()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"BEGIN",
+		"savepoint sorm_sp_1",
+		"delete from xx where id=?",
+		"savepoint sorm_sp_2",
+		"rollback to savepoint sorm_sp_2",
+		"release savepoint sorm_sp_1",
+		"savepoint sorm_sp_1",
+		"rollback to savepoint sorm_sp_1",
+		"COMMIT",
+	}
+	if !reflect.DeepEqual(rec.sqls, expect) {
+		t.Errorf("got sqls %q, expect %q", rec.sqls, expect)
+	}
+}
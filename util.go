@@ -2,21 +2,28 @@ package sorm
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
-func getFieldsForOne(ptr interface{}, optPtr []interface{}, cols []string) (scanArgs []interface{}, err error) {
+func (m *mapper) getFieldsForOne(ptr interface{}, optPtr []interface{}, cols []string) (scanArgs []interface{}, err error) {
 	v := reflect.ValueOf(ptr)
 	switch v.Kind() {
 	case reflect.Ptr: // only accept pointer
+		if v.IsNil() {
+			return nil, fmt.Errorf("nil pointer receiver argument found")
+		}
 		ind := reflect.Indirect(v) // equal with v.Elem()
 		switch ind.Kind() {
 		case reflect.Map:
-			return getScanFieldFromMap(ind, cols), nil
+			return getScanFieldFromMap(ind, cols)
 		case reflect.Struct:
-			return getScanFieldFromStruct(ind, cols), nil
+			return m.getScanFieldFromStruct(ind, cols), nil
 		default: // pointer to value
 			scanArgs = append(scanArgs, ptr)
 			for i, op := range optPtr {
@@ -32,29 +39,96 @@ func getFieldsForOne(ptr interface{}, optPtr []interface{}, cols []string) (scan
 	}
 }
 
-func getScanFieldFromMap(v reflect.Value, cols []string) (scanArgs []interface{}) {
+func getScanFieldFromMap(v reflect.Value, cols []string) (scanArgs []interface{}, err error) {
+	if v.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("the key of the receiver map must be a string, got %v", v.Type().Key())
+	}
 	fields := make(map[string]interface{})
 	for _, k := range v.MapKeys() {
-		fields[k.Interface().(string)] = v.MapIndex(k).Interface()
+		fields[k.String()] = v.MapIndex(k).Interface()
 	}
-	return getFields(fields, cols)
+	return getFields(fields, cols), nil
 }
 
-func getScanFieldFromStruct(v reflect.Value, cols []string) (scanArgs []interface{}) {
-	fields := make(map[string]interface{})
-	for i := 0; i < v.NumField(); i++ {
-		fieldInfo := v.Type().Field(i) // a reflect.StructField
-		ti := parseTag(fieldInfo.Name, fieldInfo.Tag.Get("sorm"))
-		if ti != nil && ti.fn != "_" {
-			fields[ti.fn] = v.Field(i).Addr().Interface()
+func (m *mapper) getScanFieldFromStruct(v reflect.Value, cols []string) (scanArgs []interface{}) {
+	meta := m.structMeta(v.Type())
+	for _, name := range cols {
+		key := name
+		index, ok := meta.columns[key]
+		if !ok {
+			// a qualified column such as "u.id" falls back to the plain field
+			if i := strings.LastIndexByte(name, '.'); i >= 0 {
+				key = name[i+1:]
+				index, ok = meta.columns[key]
+			}
+		}
+		if !ok { // no receiver found in the struct, use a raw bytes to receive
+			scanArgs = append(scanArgs, new(sql.RawBytes))
+			continue
+		}
+		f, _ := fieldByIndex(v, index, true)
+		if meta.nullzero[key] {
+			scanArgs = append(scanArgs, &nullZero{field: f, ptr: reflect.New(reflect.PtrTo(f.Type()))})
+			continue
+		}
+		scanArgs = append(scanArgs, f.Addr().Interface())
+	}
+	return scanArgs
+}
+
+// nullZero receives a column of a field tagged by nullzero, a NULL is set as
+// the zero value of the field.
+type nullZero struct {
+	field reflect.Value
+	ptr   reflect.Value // a **T receiving the column, T is the type of the field
+}
+
+func (n *nullZero) set() {
+	if p := n.ptr.Elem(); p.IsNil() {
+		n.field.Set(reflect.Zero(n.field.Type()))
+	} else {
+		n.field.Set(p.Elem())
+	}
+}
+
+// scanRow scans the current row into the receivers, which may contain the
+// nullZero ones returned by getScanFieldFromStruct.
+func scanRow(rows *sql.Rows, scanArgs []interface{}) (err error) {
+	var dest []interface{}
+	for i, arg := range scanArgs {
+		if n, ok := arg.(*nullZero); ok {
+			if dest == nil {
+				dest = make([]interface{}, len(scanArgs))
+				copy(dest, scanArgs)
+			}
+			dest[i] = n.ptr.Interface()
 		}
 	}
-	return getFields(fields, cols)
+	if dest == nil {
+		return rows.Scan(scanArgs...)
+	}
+
+	err = rows.Scan(dest...)
+	if err != nil {
+		return err
+	}
+	for _, arg := range scanArgs {
+		if n, ok := arg.(*nullZero); ok {
+			n.set()
+		}
+	}
+	return nil
 }
 
 func getFields(fields map[string]interface{}, cols []string) (scanArgs []interface{}) {
 	for _, name := range cols {
 		f := fields[name]
+		if f == nil {
+			// a qualified column such as "u.id" falls back to the plain field
+			if i := strings.LastIndexByte(name, '.'); i >= 0 {
+				f = fields[name[i+1:]]
+			}
+		}
 		if f == nil { // no receiver found in the struct, use a raw bytes to receive
 			f = new(sql.RawBytes)
 		}
@@ -63,35 +137,271 @@ func getFields(fields map[string]interface{}, cols []string) (scanArgs []interfa
 	return scanArgs
 }
 
-// name, value pointer for a struct field.
+// the mapping of a struct field, parsed from the tag.
 type tagInfo struct {
-	fn string
-	fp reflect.Value
+	fn       string
+	index    []int  // index sequence for reflect.Value.FieldByIndex
+	table    string // alias of the joined table, for a nested struct field
+	prefix   string // prefix of the columns, for a nested struct field
+	pk       bool   // part of the primary key
+	autoincr bool   // generated by the database
+	nullzero bool   // the zero value is written as NULL, and NULL is read as the zero value
+
+	omitempty  bool // not written if it's zero, so that the default of the column applies
+	readonly   bool // never written, such as a computed column
+	insertonly bool // written by insert but not by update
+}
+
+// fieldValue is a mapped field of a struct value.
+type fieldValue struct {
+	*tagInfo
+	fp reflect.Value // pointer of the field
+}
+
+// omitted reports whether the field is not written, by insert if update is
+// false, or by update.
+func (f *fieldValue) omitted(update bool) bool {
+	return f.readonly || update && f.insertonly || f.omitempty && f.fp.Elem().IsZero()
+}
+
+// value returns the argument of the field for insert and update, a nil
+// pointer is written as NULL by database/sql.
+func (f *fieldValue) value() interface{} {
+	if f.nullzero && f.fp.Elem().IsZero() {
+		return nil
+	}
+	return f.fp.Interface()
+}
+
+// structMeta is the mapping of a struct type, it's parsed once and cached.
+type structMeta struct {
+	fields   []*tagInfo       // the writable fields, in the order of the declaration, embedded structs flattened
+	pks      []*tagInfo       // the fields tagged by pk
+	columns  map[string][]int // receivers of the columns, including the qualified ones of the nested structs
+	nullzero map[string]bool  // the columns tagged by nullzero
+
+	parsing map[reflect.Type]bool // the structs being parsed, to stop at a recursive one
+}
+
+// mapper maps the structs by a naming strategy, the mappings are cached per
+// mapper, as a type is mapped differently by the strategies.
+type mapper struct {
+	naming NamingStrategy
+	metas  sync.Map // reflect.Type -> *structMeta
+}
+
+// defaultMapper maps the structs by LowerCase.
+var defaultMapper = newMapper(LowerCase)
+
+func newMapper(naming NamingStrategy) *mapper {
+	if naming == nil {
+		naming = LowerCase
+	}
+	return &mapper{naming: naming}
+}
+
+func (m *mapper) structMeta(t reflect.Type) *structMeta {
+	if meta, ok := m.metas.Load(t); ok {
+		return meta.(*structMeta)
+	}
+
+	meta := &structMeta{columns: make(map[string][]int), nullzero: make(map[string]bool), parsing: make(map[reflect.Type]bool)}
+	m.parse(meta, t, nil, "", "")
+	meta.parsing = nil
+	for _, ti := range meta.fields {
+		if ti.pk {
+			meta.pks = append(meta.pks, ti)
+		}
+	}
+	actual, _ := m.metas.LoadOrStore(t, meta)
+	return actual.(*structMeta)
+}
+
+// parse adds the fields of t. An embedded struct or struct pointer is
+// flattened, so are the nested struct fields tagged by `sorm:"prefix=addr_"`,
+// whose columns are prefixed. A nested struct field tagged by `sorm:"table=u"` receives the
+// columns qualified by the table alias, such as "u.id", but it's not written
+// by insert and update.
+func (m *mapper) parse(meta *structMeta, t reflect.Type, index []int, qualifier, prefix string) {
+	meta.parsing[t] = true
+	defer delete(meta.parsing, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		fieldInfo := t.Field(i) // a reflect.StructField
+		if !fieldInfo.IsExported() && !(fieldInfo.Anonymous && isNestedStruct(fieldInfo.Type)) {
+			// an unexported field can't be set, but the exported fields of an
+			// unexported embedded struct can, an unexported embedded pointer
+			// can't be allocated either, nor can an unexported embedded
+			// struct be a column, such as struct{ sql.NullString }
+			continue
+		}
+		ti := parseTag(m.naming(fieldInfo.Name), fieldInfo.Tag.Get("sorm"))
+		if ti.fn == "_" {
+			continue
+		}
+
+		ti.index = make([]int, len(index)+1)
+		copy(ti.index, index)
+		ti.index[len(index)] = i
+		st := fieldInfo.Type
+		if st.Kind() == reflect.Ptr {
+			st = st.Elem()
+		}
+		if isNestedStruct(st) && (ti.table != "" || ti.prefix != "" || fieldInfo.Anonymous) {
+			if meta.parsing[st] {
+				// a recursive struct such as `type Node struct{ *Node }`
+				continue
+			}
+			if ti.table != "" {
+				m.parse(meta, st, ti.index, ti.table+".", prefix+ti.prefix)
+			} else {
+				m.parse(meta, st, ti.index, qualifier, prefix+ti.prefix)
+			}
+			continue
+		}
+
+		ti.fn = prefix + ti.fn
+		col := qualifier + ti.fn
+		if old, ok := meta.columns[col]; ok && len(old) <= len(ti.index) {
+			// the shallower field of the same column wins, then the first one
+			continue
+		}
+		meta.columns[col] = ti.index
+		if ti.nullzero {
+			meta.nullzero[col] = true
+		} else {
+			delete(meta.nullzero, col)
+		}
+		if qualifier != "" {
+			continue
+		}
+		meta.fields = replaceField(meta.fields, ti)
+	}
 }
 
-func getFieldInfoFromStruct(v reflect.Value) (fields map[string]*tagInfo) {
-	fields = make(map[string]*tagInfo)
-	for i := 0; i < v.NumField(); i++ {
-		fieldInfo := v.Type().Field(i) // a reflect.StructField
-		tag := fieldInfo.Tag           // a reflect.StructTag
+// replaceField replaces the field of the same column in fields, or appends
+// ti if there is none.
+func replaceField(fields []*tagInfo, ti *tagInfo) []*tagInfo {
+	for i, f := range fields {
+		if f.fn == ti.fn {
+			fields[i] = ti
+			return fields
+		}
+	}
+	return append(fields, ti)
+}
 
-		ti := parseTag(fieldInfo.Name, tag.Get("sorm"))
-		ti.fp = v.Field(i).Addr()
-		if ti != nil && ti.fn != "_" {
-			fields[ti.fn] = ti
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// isNestedStruct reports whether the fields of a struct type are mapped to
+// the columns, a struct which is a value of one column, such as time.Time or
+// sql.NullString, is not nested.
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	return !t.Implements(valuerType) && !pt.Implements(valuerType) && !pt.Implements(scannerType)
+}
+
+// fieldByIndex returns the field of index, the nil embedded pointers on the
+// way are allocated if alloc is true, otherwise ok is false.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (f reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
 		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// getFieldInfoFromStruct returns the fields in the order of the declaration,
+// so that the generated sql is stable.
+func (m *mapper) getFieldInfoFromStruct(v reflect.Value) (fields []*fieldValue) {
+	v = addressable(v)
+	meta := m.structMeta(v.Type())
+	fields = make([]*fieldValue, 0, len(meta.fields))
+	for _, ti := range meta.fields {
+		f, ok := fieldByIndex(v, ti.index, false)
+		if !ok {
+			// under a nil embedded pointer, it's left to the database
+			continue
+		}
+		fields = append(fields, &fieldValue{tagInfo: ti, fp: f.Addr()})
 	}
 	return fields
 }
 
+// addressable returns v if it's addressable, otherwise a copy of v, such as
+// a struct passed to Insert by value.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Elem()
+}
+
+// sortedMapKeys returns the keys of a map[string]interface{} in sorted order.
+func sortedMapKeys(v reflect.Value) (keys []reflect.Value, err error) {
+	if v.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("the key of the map must be a string, got %v", v.Type().Key())
+	}
+	keys = v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys, nil
+}
+
+// getPrimaryKeyFromStruct returns the fields tagged by pk, in the order of
+// the declaration.
+func (m *mapper) getPrimaryKeyFromStruct(v reflect.Value) (keys []*fieldValue) {
+	v = addressable(v)
+	meta := m.structMeta(v.Type())
+	keys = make([]*fieldValue, len(meta.pks))
+	for i, ti := range meta.pks {
+		f, ok := fieldByIndex(v, ti.index, false)
+		if !ok {
+			// under a nil embedded pointer, the key is zero
+			f = reflect.New(v.Type().FieldByIndex(ti.index).Type).Elem()
+		}
+		keys[i] = &fieldValue{tagInfo: ti, fp: f.Addr()}
+	}
+	return keys
+}
+
 /*
 supported tag:
+
 	`sorm:"_"`
 	`sorm:"fn=name"`
+	`sorm:"table=alias"`, for a nested struct receiving the columns of a joined table
+	`sorm:"prefix=addr_"`, for a nested struct whose columns are prefixed
+	`sorm:"pk"`, the field is part of the primary key
+	`sorm:"autoincr"`, the field is generated by the database
+	`sorm:"nullzero"`, the zero value is written as NULL, and NULL is read as the zero value
+	`sorm:"omitempty"`, the zero value is not written by insert and update, so the column default applies
+	`sorm:"readonly"`, the field is read only, such as a computed column
+	`sorm:"insertonly"`, the field is written by insert but not by update, such as created_at
+
+the options are separated by ";", such as `sorm:"fn=id;pk;autoincr"`, the
+column is named by the naming strategy unless fn is given.
 */
-func parseTag(fieldName, tag string) (ti *tagInfo) {
-	fieldName = strings.ToLower(fieldName)
-	ti = &tagInfo{fn: fieldName}
+func parseTag(column, tag string) (ti *tagInfo) {
+	ti = &tagInfo{fn: column}
 	tags := strings.Split(tag, ";")
 	if len(tags) > 0 {
 		for _, kvp := range tags {
@@ -100,9 +410,33 @@ func parseTag(fieldName, tag string) (ti *tagInfo) {
 				ti.fn = "_"
 				continue
 			}
+			if kvp == "pk" {
+				ti.pk = true
+				continue
+			}
+			if kvp == "autoincr" {
+				ti.autoincr = true
+				continue
+			}
+			if kvp == "nullzero" {
+				ti.nullzero = true
+				continue
+			}
+			if kvp == "omitempty" {
+				ti.omitempty = true
+				continue
+			}
+			if kvp == "readonly" {
+				ti.readonly = true
+				continue
+			}
+			if kvp == "insertonly" {
+				ti.insertonly = true
+				continue
+			}
 
 			kv := strings.Split(kvp, "=")
-			if len(kv) != 2 { // wrong format of orm, just use fieldname
+			if len(kv) != 2 { // wrong format of orm, just use the column
 				continue
 			}
 			kv[0] = strings.TrimSpace(kv[0])
@@ -112,10 +446,14 @@ func parseTag(fieldName, tag string) (ti *tagInfo) {
 				if kv[1] == "_" {
 					ti.fn = "_"
 				} else if kv[1] == "" {
-					ti.fn = fieldName
+					ti.fn = column
 				} else {
 					ti.fn = kv[1]
 				}
+			} else if kv[0] == "table" {
+				ti.table = kv[1]
+			} else if kv[0] == "prefix" {
+				ti.prefix = kv[1]
 			}
 		}
 	}